@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pchhabra11/amexTest/generator"
+)
+
+// batchResult is the outcome of one generation of a -batch
+type batchResult struct {
+	Out   string
+	Stats generator.GenerationStats
+	Err   error
+}
+
+// Checks the invocation-wide flag values
+func (global globalFlags) validate() error {
+	if global.manifest != "" && global.batch != "" {
+		return fmt.Errorf("-manifest and -batch can't be combined")
+	}
+	if global.batchParallel < 1 {
+		return fmt.Errorf("-batch-parallel must be at least 1")
+	}
+	return nil
+}
+
+// Runs every job of a batch, up to parallel at a time, and reports each one's result.
+// Unlike runGenerations it doesn't stop at the first failure; the exit status is 1 if
+// any job failed, or exitTimeout if the run timed out. Jobs running at once print to
+// buffers of their own, written out in job order once every job is done.
+func runBatch(ctx context.Context, jobs []job, parallel int, opts generator.Options) int {
+	if parallel > 1 {
+		for _, job := range jobs {
+			if job.opts.Clean && !job.opts.AssumeYes {
+				fmt.Printf("Error: generation %s: -clean needs -assume-yes when -batch-parallel runs generations at once\n", job.Out)
+				return 2
+			}
+		}
+	}
+
+	results := make([]batchResult, len(jobs))
+	outputs := make([]bytes.Buffer, len(jobs))
+	slots := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i := range jobs {
+		wg.Add(1)
+		go func(i int, job job) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			job.opts.Batched = true
+			if parallel > 1 {
+				job.opts.Output = &outputs[i]
+			}
+			result := batchResult{Out: job.Out}
+			start := time.Now()
+			result.Err = generator.Run(ctx, job.Generation, job.opts, &result.Stats)
+			result.Stats.Duration = time.Since(start)
+			results[i] = result
+		}(i, jobs[i])
+	}
+	wg.Wait()
+	for i := range outputs {
+		os.Stdout.Write(outputs[i].Bytes())
+	}
+
+	if opts.JSONSummary {
+		if err := writeBatchJSONSummary(os.Stdout, results); err != nil {
+			fmt.Printf("Error: writing summary: %v\n", err)
+			return 1
+		}
+	} else {
+		writeBatchSummary(os.Stdout, results, opts.Quiet)
+	}
+
+	for _, result := range results {
+		if result.Err != nil {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return exitTimeout
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// Prints one line per generation and a closing count; with quiet only failures are listed
+func writeBatchSummary(w io.Writer, results []batchResult, quiet bool) {
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+			fmt.Fprintf(w, "FAIL %s: %v\n", result.Out, result.Err)
+			continue
+		}
+		if !quiet {
+			stats := result.Stats
+			fmt.Fprintf(w, "ok   %s: %d containers, %d config files, %d skipped, %d thresholds, %d warnings in %.2fs\n",
+				result.Out, stats.Containers, stats.ConfigFiles, stats.Skipped, stats.Thresholds, stats.Warnings, stats.Duration.Seconds())
+		}
+	}
+	if failed > 0 || !quiet {
+		fmt.Fprintf(w, "%d of %d generations succeeded\n", len(results)-failed, len(results))
+	}
+}
+
+// Writes the results as a JSON array with one object per generation, shaped like
+// -json-summary's plus the generation's out path and any error
+func writeBatchJSONSummary(w io.Writer, results []batchResult) error {
+	type jobSummary struct {
+		Out string `json:"out"`
+		generator.GenerationStats
+		DurationSeconds float64 `json:"durationSeconds"`
+		Error           string  `json:"error,omitempty"`
+	}
+	summaries := make([]jobSummary, len(results))
+	for i, result := range results {
+		summaries[i] = jobSummary{Out: result.Out, GenerationStats: result.Stats, DurationSeconds: result.Stats.Duration.Seconds()}
+		if result.Err != nil {
+			summaries[i].Error = result.Err.Error()
+		}
+	}
+	return json.NewEncoder(w).Encode(summaries)
+}
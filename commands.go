@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pchhabra11/amexTest/generator"
+)
+
+// subcommand is one of the CLI's commands. Each parses its own FlagSet, holding only the
+// flag groups that apply to it; the commands other than generate stand for one of its
+// output modes.
+type subcommand struct {
+	name    string
+	args    string
+	summary string
+	groups  []flagGroup
+	// flags switch generate into the command's mode, ahead of the user's own
+	flags []string
+}
+
+// Commands in the order usage lists them; generate runs when none is named
+var subcommands = []subcommand{
+	{name: "generate", summary: "write the monitoring structure (the default when no command is given)", groups: allFlagGroups},
+	{name: "validate", summary: "check the inputs and report every problem, writing nothing (as -validate-only)",
+		groups: []flagGroup{globalFlagGroup, inputFlags, validationFlags}, flags: []string{"-validate-only"}},
+	{name: "list", summary: "print the planned tree without writing it (as -dry-run)",
+		groups: []flagGroup{globalFlagGroup, inputFlags, validationFlags, planFlags, checkFlags, reportFlags, outlineFlags}, flags: []string{"-dry-run"}},
+	{name: "diff", args: " <baseline dir>", summary: "compare the planned configs with an existing tree (as -baseline)",
+		groups: []flagGroup{globalFlagGroup, inputFlags, validationFlags, planFlags, checkFlags, reportFlags, baselineFlags}},
+}
+
+// Picks the command named by the first argument, returning it and the arguments after it.
+// Arguments that start with a flag run generate, as they did before there were commands.
+func parseCommand(args []string) (subcommand, []string, error) {
+	if len(args) == 0 || len(args[0]) > 0 && args[0][0] == '-' {
+		return subcommands[0], args, nil
+	}
+	for _, cmd := range subcommands {
+		if cmd.name == args[0] {
+			return cmd, args[1:], nil
+		}
+	}
+	return subcommand{}, nil, fmt.Errorf("unknown command %q; run with -h for the list of commands", args[0])
+}
+
+// Parses a command's arguments into fs and returns the arguments each generation's flags
+// are layered over: the command's own flags followed by the user's. Flags may come before
+// or after diff's baseline directory, which becomes -baseline; no other command takes
+// arguments.
+func (cmd subcommand) parse(fs *flag.FlagSet, opts *generator.Options, args []string) ([]string, error) {
+	flagArgs := append([]string{}, cmd.flags...)
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		parsed := args[:len(args)-fs.NArg()]
+		flagArgs = append(flagArgs, parsed...)
+		if fs.NArg() == 0 {
+			break
+		}
+		if len(parsed) > 0 && parsed[len(parsed)-1] == "--" {
+			positional = append(positional, fs.Args()...)
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(cmd.flags) > 0 {
+		// The mode flags aren't among the command's own, so set them with the full set
+		mode := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+		defineFlags(mode, allFlagGroups, opts, &generator.Generation{}, &globalFlags{})
+		if err := mode.Parse(cmd.flags); err != nil {
+			return nil, err
+		}
+	}
+
+	if cmd.name == "diff" {
+		switch {
+		case len(positional) == 1:
+			opts.Baseline = positional[0]
+			flagArgs = append(flagArgs, "-baseline", positional[0])
+		case len(positional) > 1:
+			return nil, fmt.Errorf("diff takes one baseline directory, not %d arguments", len(positional))
+		case opts.Baseline == "":
+			return nil, fmt.Errorf("diff needs a baseline directory, as its argument or -baseline")
+		}
+		return flagArgs, nil
+	}
+	if len(positional) > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", positional[0])
+	}
+	return flagArgs, nil
+}
+
+// Returns the usage message for a command, listing the other commands when it is generate
+func (cmd subcommand) usage(fs *flag.FlagSet) func() {
+	program := filepath.Base(os.Args[0])
+	return func() {
+		out := fs.Output()
+		if cmd.name == "generate" {
+			fmt.Fprintf(out, "Usage: %s [command] [flags]\n\nCommands:\n", program)
+			for _, other := range subcommands {
+				fmt.Fprintf(out, "  %-9s %s\n", other.name, other.summary)
+			}
+			fmt.Fprintf(out, "\nThe other commands take only the flags that apply to them; run %s <command> -h for theirs.\n\nFlags:\n", program)
+		} else {
+			fmt.Fprintf(out, "Usage: %s %s [flags]%s\n\n%s\n\nFlags:\n", program, cmd.name, cmd.args, cmd.summary)
+		}
+		fs.PrintDefaults()
+	}
+}
@@ -0,0 +1,134 @@
+package generator
+
+import (
+	"archive/zip"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// multiWriter fans each config out to several writers, writing to all of them even when one
+// leaves the config alone or fails. It is a dirWriter, creating directories in those that are.
+type multiWriter []Writer
+
+// MkdirAll creates the directory in every dirWriter, returning all of their errors joined
+func (m multiWriter) MkdirAll(path string) error {
+	var errs []error
+	for _, w := range m {
+		if dirs, ok := w.(dirWriter); ok {
+			if err := dirs.MkdirAll(path); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WriteConfig writes the config to every writer and returns all of their errors joined, or
+// errSkipped if a writer skipped the config and none failed
+func (m multiWriter) WriteConfig(path string, data []byte) error {
+	skipped := false
+	var errs []error
+	for _, w := range m {
+		if err := w.WriteConfig(path, data); errors.Is(err, errSkipped) {
+			skipped = true
+		} else if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	if skipped {
+		return errSkipped
+	}
+	return nil
+}
+
+// zipWriter is a Writer that stores configs in a zip archive, for -archive. Like the output
+// tree, a path written twice keeps the last config, so entries are held until Close writes them
+// in path order. They carry no modification time, so archives of the same inputs are
+// byte-identical.
+type zipWriter struct {
+	path string
+	file *os.File
+	// entries maps each slash-separated entry name to its data, nil for directories
+	entries map[string][]byte
+}
+
+// Creates the archive at path, replacing any existing file
+func newZipWriter(path string) (*zipWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, describeFSError("creating archive", path, err)
+	}
+	return &zipWriter{path: path, file: file, entries: make(map[string][]byte)}, nil
+}
+
+// MkdirAll adds a directory entry for path and each of its parents, so containers without a
+// config are still in the archive
+func (w *zipWriter) MkdirAll(path string) error {
+	w.addDirs(path)
+	return nil
+}
+
+func (w *zipWriter) WriteConfig(path string, data []byte) error {
+	w.addDirs(filepath.Dir(path))
+	w.entries[filepath.ToSlash(path)] = data
+	return nil
+}
+
+func (w *zipWriter) addDirs(path string) {
+	for dir := filepath.Clean(path); dir != "."; dir = filepath.Dir(dir) {
+		name := filepath.ToSlash(dir) + "/"
+		if _, added := w.entries[name]; added {
+			return
+		}
+		w.entries[name] = nil
+	}
+}
+
+// Writes the entries, each directory before what it holds, and finishes the archive
+func (w *zipWriter) Close() error {
+	names := make([]string, 0, len(w.entries))
+	for name := range w.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	archive := zip.NewWriter(w.file)
+	err := func() error {
+		for _, name := range names {
+			header := &zip.FileHeader{Name: name, Method: zip.Deflate}
+			header.SetMode(0644)
+			if strings.HasSuffix(name, "/") {
+				header.Method = zip.Store
+				header.SetMode(os.ModeDir | 0755)
+			}
+			entry, err := archive.CreateHeader(header)
+			if err != nil {
+				return err
+			}
+			if _, err := entry.Write(w.entries[name]); err != nil {
+				return err
+			}
+		}
+		return archive.Close()
+	}()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(w.path)
+		return describeFSError("writing archive", w.path, err)
+	}
+	return nil
+}
+
+// Abandons an archive a failed run left unfinished, removing the file
+func (w *zipWriter) discard() {
+	w.file.Close()
+	os.Remove(w.path)
+}
@@ -0,0 +1,104 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"path/filepath"
+	"testing"
+)
+
+// failingWriter fails every write with its error
+type failingWriter struct {
+	err error
+}
+
+func (w failingWriter) WriteConfig(path string, data []byte) error {
+	return w.err
+}
+
+// Every writer gets the config even after one fails, and every failure is returned
+func TestMultiWriterJoinsErrors(t *testing.T) {
+	first, second := errors.New("disk full"), errors.New("read-only")
+	files := &mapWriter{files: make(map[string][]byte)}
+	out := multiWriter{failingWriter{first}, files, failingWriter{second}}
+
+	err := out.WriteConfig("checkout/config.yaml", []byte("source: {}\n"))
+	if !errors.Is(err, first) || !errors.Is(err, second) {
+		t.Errorf("WriteConfig = %v, want both writers' errors", err)
+	}
+	if _, written := files.files["checkout/config.yaml"]; !written {
+		t.Error("config not written to the writer after the failing one")
+	}
+}
+
+// A skip is reported only when no writer failed
+func TestMultiWriterSkipped(t *testing.T) {
+	files := &mapWriter{files: make(map[string][]byte)}
+	if err := (multiWriter{files, failingWriter{errSkipped}}).WriteConfig("a/config.yaml", nil); !errors.Is(err, errSkipped) {
+		t.Errorf("WriteConfig = %v, want errSkipped", err)
+	}
+	failed := errors.New("disk full")
+	if err := (multiWriter{failingWriter{errSkipped}, failingWriter{failed}}).WriteConfig("a/config.yaml", nil); !errors.Is(err, failed) || errors.Is(err, errSkipped) {
+		t.Errorf("WriteConfig = %v, want only the failure", err)
+	}
+}
+
+// Each -out mirror receives the same tree and .generated manifest as the output directory
+func TestRunWritesMirrors(t *testing.T) {
+	defer SetLogger(logger)
+	SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	root := t.TempDir()
+	opts := DefaultOptions()
+	opts.Quiet = true
+	opts.Mirrors = []string{filepath.Join(root, "mirror")}
+	gen := Generation{Out: filepath.Join(root, "out"), JSONData: []byte(statsJSON), YAMLData: []byte(statsYAML)}
+	if err := Run(context.Background(), gen, opts, &GenerationStats{}); err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := readGeneratedManifest(gen.Out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 3 {
+		t.Fatalf("manifest lists %q, want 3 configs", paths)
+	}
+	mirrored, err := readGeneratedManifest(opts.Mirrors[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mirrored) != len(paths) {
+		t.Errorf("mirror manifest lists %q, want %q", mirrored, paths)
+	}
+	for _, path := range paths {
+		want, err := ioutil.ReadFile(filepath.Join(gen.Out, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadFile(filepath.Join(opts.Mirrors[0], path))
+		if err != nil {
+			t.Errorf("mirror: %v", err)
+		} else if string(got) != string(want) {
+			t.Errorf("mirror %s = %q, want %q", path, got, want)
+		}
+	}
+}
+
+// The same directory can't be given to -out twice
+func TestRunRejectsRepeatedOut(t *testing.T) {
+	defer SetLogger(logger)
+	SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	out := t.TempDir()
+	opts := DefaultOptions()
+	opts.Quiet = true
+	opts.Mirrors = []string{out + string(filepath.Separator)}
+	gen := Generation{Out: out, JSONData: []byte(statsJSON), YAMLData: []byte(statsYAML)}
+	if err := Run(context.Background(), gen, opts, &GenerationStats{}); err == nil {
+		t.Error("Run succeeded with the output directory given twice")
+	}
+}
@@ -0,0 +1,162 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+)
+
+// AuditFinding is one discrepancy between the generated tree on disk and the tree the current
+// inputs produce
+type AuditFinding struct {
+	Path string `yaml:"path" json:"path"`
+	// Problem is missing, extra or changed
+	Problem string `yaml:"problem" json:"problem"`
+	// Line is the first line that differs in a changed file
+	Line int `yaml:"line,omitempty" json:"line,omitempty"`
+}
+
+// AuditReport is the document written in -audit mode
+type AuditReport struct {
+	Findings []AuditFinding `yaml:"findings" json:"findings"`
+}
+
+// mapWriter is a Writer that keeps configs in memory, keyed by slash-separated path
+type mapWriter struct {
+	files map[string][]byte
+}
+
+func (w *mapWriter) WriteConfig(path string, data []byte) error {
+	w.files[filepath.ToSlash(path)] = data
+	return nil
+}
+
+// GenerateToMap generates plan in memory instead of on disk, returning each config file's
+// contents by its slash-separated path relative to the output root. Progress output and
+// -write-rate pacing are turned off; everything else in opts applies as it would to a write.
+func GenerateToMap(ctx context.Context, plan []ContainerConfig, opts Options) (map[string][]byte, error) {
+	w := &mapWriter{files: make(map[string][]byte)}
+	opts.Quiet = true
+	opts.WriteRate = 0
+	if err := createStructureAndYaml(ctx, w, plan, opts, &GenerationStats{}); err != nil {
+		return nil, err
+	}
+	return w.files, nil
+}
+
+// Files the generator writes at the output root besides configs, which the audit doesn't
+// expect to match a particular content
+var auditIgnored = map[string]bool{generatedManifest: true, "checksums.txt": true, generatedPathsFile: true, ".gitignore": true, "index.yaml": true}
+
+// Compares the tree under basePath with the expected configs. Configs marked hand-maintained
+// are left out, as are the root's bookkeeping files and -dedup-files' shared copies. Only files
+// the generator owns are reported as extra: those the .generated manifest lists and those named
+// fileName, like config.yaml; anything else in the tree was put there by hand.
+func auditTree(basePath string, expected map[string][]byte, fileName string) ([]AuditFinding, error) {
+	previous, err := readGeneratedManifest(basePath)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s manifest: %v", generatedManifest, err)
+	}
+	owned := make(map[string]bool, len(previous))
+	for _, path := range previous {
+		owned[filepath.ToSlash(path)] = true
+	}
+
+	var findings []AuditFinding
+	paths := make([]string, 0, len(expected))
+	for path := range expected {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fullPath := filepath.Join(basePath, filepath.FromSlash(path))
+		if manualOverride(filepath.Dir(fullPath), filepath.Base(fullPath)) != "" {
+			continue
+		}
+		actual, err := ioutil.ReadFile(fullPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			findings = append(findings, AuditFinding{Path: path, Problem: "missing"})
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(actual, expected[path]) {
+			findings = append(findings, AuditFinding{Path: path, Problem: "changed", Line: firstDifferentLine(actual, expected[path])})
+		}
+	}
+
+	err = filepath.WalkDir(basePath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == basePath && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		rel, err := filepath.Rel(basePath, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if entry.IsDir() {
+			if rel == sharedDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if _, ok := expected[rel]; ok || auditIgnored[rel] || !owned[rel] && entry.Name() != fileName {
+			return nil
+		}
+		if manualOverride(filepath.Dir(path), entry.Name()) != "" {
+			return nil
+		}
+		findings = append(findings, AuditFinding{Path: rel, Problem: "extra"})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return findings, nil
+}
+
+// Returns the 1-based number of the first line where a and b differ
+func firstDifferentLine(a, b []byte) int {
+	aLines := bytes.Split(a, []byte("\n"))
+	bLines := bytes.Split(b, []byte("\n"))
+	for i := 0; i < len(aLines) && i < len(bLines); i++ {
+		if !bytes.Equal(aLines[i], bLines[i]) {
+			return i + 1
+		}
+	}
+	if len(aLines) < len(bLines) {
+		return len(aLines) + 1
+	}
+	return len(bLines) + 1
+}
+
+// Writes the audit report as YAML or JSON
+func writeAudit(w io.Writer, format string, indent int, findings []AuditFinding) error {
+	report := AuditReport{Findings: findings}
+	if report.Findings == nil {
+		report.Findings = []AuditFinding{}
+	}
+
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	data, err := encodeYAML(report, indent)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
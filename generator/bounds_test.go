@@ -0,0 +1,89 @@
+package generator
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func bounds(threshold MetricThreshold) string {
+	format := func(bound *float64) string {
+		if bound == nil {
+			return "-"
+		}
+		return strconv.FormatFloat(*bound, 'f', -1, 64)
+	}
+	return format(threshold.Min) + ".." + format(threshold.Max)
+}
+
+func TestResolvedBoundsScale(t *testing.T) {
+	defaults := DefaultConfig{Min: float(1), Max: float(2)}
+	for _, test := range []struct {
+		name      string
+		threshold MetricThreshold
+		want      string
+	}{
+		{"GB to bytes", MetricThreshold{Min: float(0.5), Max: float(8), Scale: float(1 << 30)}, "536870912..8589934592"},
+		{"fraction", MetricThreshold{Max: float(50), Scale: float(0.25)}, "1..12.5"},
+		{"negative bounds", MetricThreshold{Min: float(-4), Max: float(-1), Scale: float(1000)}, "-4000..-1000"},
+		{"defaults stay in output units", MetricThreshold{Max: float(3), Scale: float(10)}, "1..30"},
+		{"no scale", MetricThreshold{Min: float(5), Max: float(6)}, "5..6"},
+		{"scale without bounds", MetricThreshold{Scale: float(10)}, "1..2"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			resolved := resolvedBounds(test.threshold, defaults)
+			if got := bounds(resolved); got != test.want {
+				t.Errorf("bounds = %s, want %s", got, test.want)
+			}
+			if resolved.Scale != nil {
+				t.Errorf("scale = %v, want it dropped once applied", *resolved.Scale)
+			}
+		})
+	}
+}
+
+// The scale applies before -threshold-scale loosens the bounds
+func TestCreateContainerYamlScaleThenThresholdScale(t *testing.T) {
+	container := Container{ContainerName: "disks", Graphs: []Graph{{GraphName: "usage", GraphMetadata: []GraphMeta{{EntityID: "disk", MetricID: "bytes"}}}}}
+	config := Config{Source: Source{Entity: Entity{MetricThresholds: []MetricThreshold{
+		{EntityID: "disk", MetricID: "bytes", Min: float(1), Max: float(4), Scale: float(1e9)},
+	}}}}
+	opts := DefaultOptions()
+	opts.ThresholdScale = 2
+
+	generated, _, _ := createContainerYaml(config, container, opts)
+	thresholds := generated.Source.Entity.MetricThresholds
+	if len(thresholds) != 1 || bounds(thresholds[0]) != "500000000..8000000000" || thresholds[0].Scale != nil {
+		t.Fatalf("thresholds = %+v, want bytes 5e8..8e9 without a scale", thresholds)
+	}
+	data, err := marshalConfig(generated, opts.configStyle())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "scale:") {
+		t.Errorf("generated config carries the scale:\n%s", data)
+	}
+}
+
+func TestValidateScale(t *testing.T) {
+	for _, test := range []struct {
+		threshold string
+		want      string
+	}{
+		{"{entityId: api, metricId: bytes, max: 8, scale: 1073741824}", ""},
+		{"{entityId: api, metricId: bytes, max: 8, scale: 0}", "scale 0 must be positive"},
+		{"{entityId: api, metricId: bytes, max: 8, scale: -1}", "scale -1 must be positive"},
+		{"{entityId: api, metricId: bytes, max: 8, scale: .nan}", "scale NaN must be positive"},
+		{"{entityId: api, metricId: bytes, max: 8, scale: .inf}", "scale +Inf must be a finite number"},
+		{"{entityId: api, metricId: bytes, max: 1e300, scale: 1e10}", "scale 1e+10 takes the bounds to max +Inf"},
+		{"{entityId: api, metricId: bytes, min: 2, max: 3, scale: 0.5}", ""},
+	} {
+		problems := validationProblems(t, configYAML("", "    - "+test.threshold+"\n"))
+		switch {
+		case test.want == "" && len(problems) > 0:
+			t.Errorf("%s: problems = %q, want none", test.threshold, problems)
+		case test.want != "" && (len(problems) != 1 || !strings.HasSuffix(problems[0], ": "+test.want)):
+			t.Errorf("%s: problems = %q, want %q", test.threshold, problems, test.want)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package generator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Writes checksums.txt at the output root for -gen-checksums, in sha256sum format, covering
+// every generated file. Hashes computed while writing are reused; files kept from an earlier
+// run by a partial generation are hashed from disk.
+func writeChecksums(basePath string, generated []string, computed map[string]string) error {
+	paths := unionPaths(generated, nil)
+	sort.Slice(paths, func(i, j int) bool { return filepath.ToSlash(paths[i]) < filepath.ToSlash(paths[j]) })
+
+	var lines []string
+	for _, path := range paths {
+		sum, ok := computed[path]
+		if !ok {
+			data, err := ioutil.ReadFile(filepath.Join(basePath, path))
+			if err != nil {
+				// Removed since the manifest was written; there is nothing to vouch for
+				continue
+			}
+			sum = contentHash(data)
+		}
+		lines = append(lines, fmt.Sprintf("%s  %s", sum, filepath.ToSlash(path)))
+	}
+
+	checksumsPath := filepath.Join(basePath, "checksums.txt")
+	if err := ioutil.WriteFile(checksumsPath, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return describeFSError("writing checksums", checksumsPath, err)
+	}
+	return nil
+}
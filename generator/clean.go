@@ -0,0 +1,144 @@
+package generator
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Lists every file a generation wrote, relative to the output root, so -clean only ever
+// touches files this tool produced
+const generatedManifest = ".generated"
+
+// Reads the output root's .generated manifest; a missing manifest lists nothing
+func readGeneratedManifest(basePath string) ([]string, error) {
+	file, err := os.Open(filepath.Join(basePath, generatedManifest))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var paths []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			paths = append(paths, filepath.FromSlash(line))
+		}
+	}
+	return paths, scanner.Err()
+}
+
+// Writes the .generated manifest listing paths, sorted and without duplicates
+func writeGeneratedManifest(basePath string, paths []string) error {
+	sorted := make([]string, 0, len(paths))
+	for _, path := range unionPaths(paths, nil) {
+		sorted = append(sorted, filepath.ToSlash(path))
+	}
+	sort.Strings(sorted)
+
+	content := "# Files written by the monitoring structure generator; -clean removes only these\n" + strings.Join(sorted, "\n") + "\n"
+	manifestPath := filepath.Join(basePath, generatedManifest)
+	if err := ioutil.WriteFile(manifestPath, []byte(content), 0644); err != nil {
+		return describeFSError("writing generated files manifest", manifestPath, err)
+	}
+	return nil
+}
+
+// Merges two path lists without duplicates
+func unionPaths(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	var union []string
+	for _, path := range append(append([]string{}, a...), b...) {
+		if !seen[path] {
+			seen[path] = true
+			union = append(union, path)
+		}
+	}
+	return union
+}
+
+// Finds the files an earlier run generated, per its manifest, that this run no longer does,
+// such as those of renamed or removed containers. Files the manifest doesn't list, and
+// hand-maintained configs (see manualOverride), are never orphans.
+func findOrphans(basePath string, previous, current []string) []string {
+	generated := make(map[string]bool, len(current))
+	for _, path := range current {
+		generated[path] = true
+	}
+
+	var orphans []string
+	for _, path := range previous {
+		full := filepath.Join(basePath, path)
+		if generated[path] || !withinBase(path) {
+			continue
+		}
+		if _, err := os.Lstat(full); err != nil {
+			continue
+		}
+		if manualOverride(filepath.Dir(full), filepath.Base(full)) == "" {
+			orphans = append(orphans, full)
+		}
+	}
+	return orphans
+}
+
+// Removes orphaned files under basePath for -clean, then the directories they leave empty.
+// Without assumeYes it asks on the terminal first, and removes nothing when stdin isn't one.
+func cleanOrphans(basePath string, previous, current []string, assumeYes bool) error {
+	orphans := findOrphans(basePath, previous, current)
+	if len(orphans) == 0 {
+		return nil
+	}
+
+	if !assumeYes {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			logger.Warn("not removing orphaned files without confirmation; pass -assume-yes", "count", len(orphans), "path", basePath)
+			return nil
+		}
+		if !confirm(fmt.Sprintf("Remove %d orphaned generated file(s) under %s?", len(orphans), basePath)) {
+			logger.Info("kept orphaned files", "count", len(orphans))
+			return nil
+		}
+	}
+
+	dirs := make(map[string]bool)
+	for _, orphan := range orphans {
+		if err := os.Remove(orphan); err != nil {
+			return describeFSError("removing orphaned file", orphan, err)
+		}
+		logger.Debug("removed orphaned file", "path", orphan)
+		for dir := filepath.Dir(orphan); dir != basePath && strings.HasPrefix(dir, basePath); dir = filepath.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+
+	// Deepest first, so parents empty out before they are tried; non-empty ones stay
+	var emptied []string
+	for dir := range dirs {
+		emptied = append(emptied, dir)
+	}
+	sort.Slice(emptied, func(i, j int) bool { return len(emptied[i]) > len(emptied[j]) })
+	for _, dir := range emptied {
+		os.Remove(dir)
+	}
+	logger.Info("removed orphaned files", "count", len(orphans))
+	return nil
+}
+
+// Asks a yes/no question on the terminal; anything but y or yes is no
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
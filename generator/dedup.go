@@ -0,0 +1,66 @@
+package generator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Directory under the output root holding configs shared by several containers with -dedup-files
+const sharedDir = "_shared"
+
+// Returns the content hashes of the marshaled configs that more than one container would write
+func sharedContents(plan []ContainerConfig, style configStyle) (map[string]bool, error) {
+	counts := make(map[string]int)
+	for _, planned := range plan {
+		if !planned.WriteConfig {
+			continue
+		}
+		data, err := marshalConfig(planned.Config, style)
+		if err != nil {
+			return nil, err
+		}
+		counts[contentHash(data)]++
+	}
+	shared := make(map[string]bool)
+	for hash, count := range counts {
+		if count > 1 {
+			shared[hash] = true
+		}
+	}
+	return shared, nil
+}
+
+// Identifies marshaled config content
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Points yamlPath at the shared config sharedPath with a relative symlink, falling back to a
+// copy of data where the filesystem can't link
+func linkShared(sharedPath, yamlPath string, data []byte) error {
+	target, err := filepath.Rel(filepath.Dir(yamlPath), sharedPath)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(yamlPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Symlink(target, yamlPath); err != nil {
+		logger.Debug("symlink failed, copying shared config", "path", yamlPath, "error", err)
+		return ioutil.WriteFile(yamlPath, data, 0644)
+	}
+	return nil
+}
+
+// Removes path if it is a symlink left by an earlier -dedup-files run, so writing a regular
+// config there doesn't overwrite the shared file behind it
+func removeLink(path string) error {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return os.Remove(path)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// ContainerDiff lists how a container's thresholds changed relative to the baseline
+type ContainerDiff struct {
+	Path    string            `yaml:"path" json:"path"`
+	Added   []MetricThreshold `yaml:"added,omitempty" json:"added,omitempty"`
+	Removed []MetricThreshold `yaml:"removed,omitempty" json:"removed,omitempty"`
+	Changed []ThresholdChange `yaml:"changed,omitempty" json:"changed,omitempty"`
+}
+
+// ThresholdChange pairs the baseline and current versions of a threshold with the same -dedup-key fields
+type ThresholdChange struct {
+	Before MetricThreshold `yaml:"before" json:"before"`
+	After  MetricThreshold `yaml:"after" json:"after"`
+}
+
+// BaselineDiff is the document written in -baseline mode
+type BaselineDiff struct {
+	Containers []ContainerDiff `yaml:"containers" json:"containers"`
+}
+
+// Compares the planned configs against the config files, named fileName, under baselineDir,
+// matching thresholds up by key. Only containers with differences are returned; baseline
+// containers that are no longer planned report all of their thresholds as removed.
+func diffAgainstBaseline(baselineDir, fileName string, key dedupKey, planned []ContainerConfig) ([]ContainerDiff, error) {
+	baseline, err := loadBaseline(baselineDir, fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []ContainerDiff
+	seen := make(map[string]bool)
+	for _, container := range planned {
+		if !container.WriteConfig {
+			continue
+		}
+		seen[container.Path] = true
+		diff := diffThresholds(container.Path, key, baseline[container.Path], container.Config.Source.Entity.MetricThresholds)
+		if !diff.empty() {
+			diffs = append(diffs, diff)
+		}
+	}
+
+	var removedPaths []string
+	for path := range baseline {
+		if !seen[path] {
+			removedPaths = append(removedPaths, path)
+		}
+	}
+	sort.Strings(removedPaths)
+	for _, path := range removedPaths {
+		diff := diffThresholds(path, key, baseline[path], nil)
+		if !diff.empty() {
+			diffs = append(diffs, diff)
+		}
+	}
+	return diffs, nil
+}
+
+// Loads every config file named fileName under baselineDir, keyed by its directory relative
+// to baselineDir
+func loadBaseline(baselineDir, fileName string) (map[string][]MetricThreshold, error) {
+	baseline := make(map[string][]MetricThreshold)
+	err := filepath.Walk(baselineDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name() != fileName {
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("error reading baseline %s: %v", path, err)
+		}
+		var config Config
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			return fmt.Errorf("error parsing baseline %s: %v", path, err)
+		}
+
+		rel, err := filepath.Rel(baselineDir, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		baseline[rel] = config.Source.Entity.MetricThresholds
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return baseline, nil
+}
+
+// Computes the added, removed and changed thresholds, telling thresholds apart by key as
+// -dedup-key does
+func diffThresholds(path string, key dedupKey, before, after []MetricThreshold) ContainerDiff {
+	diff := ContainerDiff{Path: filepath.ToSlash(path)}
+
+	beforeSet := newThresholdSet(key, len(before))
+	for _, threshold := range before {
+		if beforeSet.index(threshold) < 0 {
+			beforeSet.add(threshold)
+		}
+	}
+	afterSet := newThresholdSet(key, len(after))
+
+	for _, threshold := range after {
+		if afterSet.index(threshold) < 0 {
+			afterSet.add(threshold)
+		}
+		// Descriptions are written as comments and never survive a round trip
+		threshold.Description = ""
+
+		i := beforeSet.index(threshold)
+		if i < 0 {
+			diff.Added = append(diff.Added, threshold)
+		} else if previous := beforeSet.thresholds[i]; !reflect.DeepEqual(previous, threshold) {
+			diff.Changed = append(diff.Changed, ThresholdChange{Before: previous, After: threshold})
+		}
+	}
+
+	for _, threshold := range before {
+		if afterSet.index(threshold) < 0 {
+			diff.Removed = append(diff.Removed, threshold)
+		}
+	}
+	return diff
+}
+
+// Reports whether the container's thresholds are unchanged
+func (d ContainerDiff) empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Writes the diff document as YAML or JSON
+func writeDiff(w io.Writer, format string, indent int, diffs []ContainerDiff) error {
+	document := BaselineDiff{Containers: diffs}
+	if document.Containers == nil {
+		document.Containers = []ContainerDiff{}
+	}
+
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(document)
+	}
+
+	data, err := encodeYAML(document, indent)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,93 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// PlannedFile describes one config file a generation would write, for -dry-run -format json
+type PlannedFile struct {
+	// Path is the config file path relative to the output directory
+	Path       string            `json:"path"`
+	Container  string            `json:"container"`
+	Thresholds []MetricThreshold `json:"thresholds"`
+}
+
+// ANSI SGR codes for the dry-run outline
+const (
+	ansiDir    = "1;34"
+	ansiFile   = "32"
+	ansiCount  = "1;33"
+	ansiNone   = "2"
+	ansiHeader = "1"
+)
+
+// palette wraps text in ANSI colors when enabled
+type palette struct {
+	enabled bool
+}
+
+// Returns a palette that colors output only when w is a terminal, -no-color isn't set and
+// $NO_COLOR is empty
+func newPalette(w io.Writer, noColor bool) palette {
+	file, ok := w.(*os.File)
+	return palette{enabled: ok && !noColor && os.Getenv("NO_COLOR") == "" && term.IsTerminal(int(file.Fd()))}
+}
+
+func (p palette) paint(code, text string) string {
+	if !p.enabled {
+		return text
+	}
+	return "\x1b[" + code + "m" + text + "\x1b[0m"
+}
+
+// Writes the planned tree as a human-readable outline, in color with an enabled palette:
+// directories, config files and their threshold counts each stand out, and containers
+// matching no thresholds are dimmed
+func writeDryRun(w io.Writer, basePath string, plan []ContainerConfig, colors palette) error {
+	header := fmt.Sprintf("Would write %d config file(s) under %s:", countConfigFiles(plan), basePath)
+	if _, err := fmt.Fprintln(w, colors.paint(ansiHeader, header)); err != nil {
+		return err
+	}
+	for _, planned := range plan {
+		indent := strings.Repeat("  ", planned.Depth+1)
+		line := indent + colors.paint(ansiDir, filepath.Base(planned.Path)+"/")
+		if planned.WriteConfig {
+			thresholds := len(planned.Config.Source.Entity.MetricThresholds)
+			count := colors.paint(ansiCount, fmt.Sprintf("%d thresholds", thresholds))
+			if thresholds == 0 {
+				count = colors.paint(ansiNone, "0 thresholds")
+			}
+			line += fmt.Sprintf(" %s (%s)", colors.paint(ansiFile, planned.FileName), count)
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Writes the planned tree as a single JSON array of the config files that would be written
+func writeDryRunJSON(w io.Writer, plan []ContainerConfig) error {
+	files := []PlannedFile{}
+	for _, planned := range plan {
+		if !planned.WriteConfig {
+			continue
+		}
+		files = append(files, PlannedFile{
+			Path:       filepath.ToSlash(filepath.Join(planned.Path, planned.FileName)),
+			Container:  planned.Container.ContainerName,
+			Thresholds: planned.Config.Source.Entity.MetricThresholds,
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(files)
+}
@@ -0,0 +1,118 @@
+package generator
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// explainTarget is the entity/metric pair traced by -explain
+type explainTarget struct {
+	EntityID string
+	MetricID string
+}
+
+// Parses an -explain value of the form entity=E,metric=M
+func parseExplain(spec string) (explainTarget, error) {
+	var target explainTarget
+	for _, part := range strings.Split(spec, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch strings.TrimSpace(key) {
+		case "entity":
+			target.EntityID = strings.TrimSpace(value)
+		case "metric":
+			target.MetricID = strings.TrimSpace(value)
+		default:
+			return target, fmt.Errorf("-explain %q: unknown field %q (want entity=E,metric=M)", spec, key)
+		}
+	}
+	if target.EntityID == "" || target.MetricID == "" {
+		return target, fmt.Errorf("-explain %q needs both entity and metric", spec)
+	}
+	return target, nil
+}
+
+// Traces one entity/metric pair through the run: the YAML thresholds for it, the filters that
+// apply to it, and every planned container whose graphs show it along with what it was given
+func writeExplain(w io.Writer, target explainTarget, config Config, plan []ContainerConfig, opts Options) error {
+	var b strings.Builder
+	defaults := config.Source.DefaultConfig
+	fmt.Fprintf(&b, "entityId %s metricId %s\n", target.EntityID, target.MetricID)
+
+	b.WriteString("YAML thresholds:\n")
+	found := false
+	for i, threshold := range config.Source.Entity.MetricThresholds {
+		if threshold.EntityID == target.EntityID && threshold.MetricID == target.MetricID {
+			found = true
+			fmt.Fprintf(&b, "  [%d] %s (resolved incident %s)\n", i, describeBounds(resolvedBounds(threshold, defaults)), orDash(resolvedSeverity(threshold, defaults)))
+		}
+	}
+	if !found {
+		b.WriteString("  none name this pair; only graph-level thresholds can apply\n")
+	}
+
+	b.WriteString("Filters:\n")
+	fmt.Fprintf(&b, "  -exclude-metric: %s\n", yesNo(opts.metricExcluded(target.MetricID), "excluded", "not excluded"))
+	fmt.Fprintf(&b, "  ignore: %s\n", yesNo(containsString(config.Source.Entity.Ignore.EntityIds, target.EntityID), "entity is ignored", "not ignored"))
+	switch whitelist := config.Source.Entity.Whitelist.EntityIds; {
+	case len(whitelist) == 0:
+		b.WriteString("  whitelist: empty, every entity allowed\n")
+	default:
+		fmt.Fprintf(&b, "  whitelist: %s\n", yesNo(containsString(whitelist, target.EntityID), "entity is listed", "entity is not listed"))
+	}
+	if opts.Severity != "" {
+		fmt.Fprintf(&b, "  -severity: only %s is emitted\n", normalizeSeverity(opts.Severity))
+	}
+	// Matching skips the pair outright, graph-level thresholds included
+	if opts.metricExcluded(target.MetricID) || config.Source.Entity.filtered(target.EntityID) {
+		b.WriteString("  filtered out: no container gets a threshold for this pair\n")
+	}
+
+	b.WriteString("Containers:\n")
+	shown := false
+	for _, planned := range plan {
+		if !containerShows(planned.Container, target) {
+			continue
+		}
+		shown = true
+		path := filepath.ToSlash(planned.Path)
+		applied := "no threshold"
+		for _, threshold := range planned.Config.Source.Entity.MetricThresholds {
+			if threshold.EntityID == target.EntityID && threshold.MetricID == target.MetricID {
+				applied = describeBounds(threshold)
+				break
+			}
+		}
+		if !planned.WriteConfig {
+			applied += " (no config written)"
+		}
+		fmt.Fprintf(&b, "  %s: %s\n", path, applied)
+	}
+	if !shown {
+		b.WriteString("  no planned container has graph metadata for this pair\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Reports whether one of the container's own graphs has metadata for the target pair
+func containerShows(container Container, target explainTarget) bool {
+	for _, graph := range container.Graphs {
+		for _, meta := range graph.GraphMetadata {
+			if meta.EntityID == target.EntityID && meta.MetricID == target.MetricID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns yes when condition holds, else no
+func yesNo(condition bool, yes, no string) string {
+	if condition {
+		return yes
+	}
+	return no
+}
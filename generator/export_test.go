@@ -0,0 +1,7 @@
+package generator
+
+// Unexported functions the external tests in package generator_test exercise
+var (
+	CreateContainerYaml = createContainerYaml
+	NestedContainers    = nestedContainers
+)
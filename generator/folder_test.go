@@ -0,0 +1,73 @@
+package generator
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func FuzzSanitizeFolderName(f *testing.F) {
+	for _, seed := range []string{"", ".", "..", "...", "../../etc", "/abs/path", `C:\Windows`, "a/b", "CON", "con.txt", "nul\x00", "Checkout Service", "ü"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, name string) {
+		got := sanitizeFolderName(name)
+		if got == "" {
+			t.Fatalf("sanitizeFolderName(%q) is empty", name)
+		}
+		if got == "." || got == ".." || strings.Trim(got, ".") == "" {
+			t.Fatalf("sanitizeFolderName(%q) = %q, which resolves to a parent directory", name, got)
+		}
+		if strings.ContainsAny(got, `/\:*?"<>|`) || filepath.IsAbs(got) || filepath.VolumeName(got) != "" {
+			t.Fatalf("sanitizeFolderName(%q) = %q, which isn't a single relative path component", name, got)
+		}
+		for _, r := range got {
+			if r < 0x20 || r == 0x7f {
+				t.Fatalf("sanitizeFolderName(%q) = %q, which holds control character %U", name, got, r)
+			}
+		}
+		if utf8.ValidString(name) && !utf8.ValidString(got) {
+			t.Fatalf("sanitizeFolderName(%q) = %q, which isn't valid UTF-8", name, got)
+		}
+		if base := string(filepath.Separator) + "out"; filepath.Dir(filepath.Join(base, got)) != base {
+			t.Fatalf("sanitizeFolderName(%q) = %q, which escapes its parent directory", name, got)
+		}
+		if again := sanitizeFolderName(got); again != got {
+			t.Fatalf("sanitizeFolderName(%q) = %q, but sanitizing that again gives %q", name, got, again)
+		}
+	})
+}
+
+func TestSanitizeFolderNameWindowsReserved(t *testing.T) {
+	reserved := []string{"CON", "PRN", "AUX", "NUL",
+		"COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9",
+		"LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9"}
+	for _, name := range reserved {
+		t.Run(name, func(t *testing.T) {
+			lower := strings.ToLower(name)
+			mixed := name[:1] + lower[1:]
+			for input, want := range map[string]string{
+				name:              name + "_",
+				lower:             lower + "_",
+				mixed:             mixed + "_",
+				name + ".txt":     name + "_.txt",
+				lower + ".tar.gz": lower + "_.tar.gz",
+				name + "X":        name + "X",
+				"my" + name:       "my" + name,
+			} {
+				if got := sanitizeFolderName(input); got != want {
+					t.Errorf("sanitizeFolderName(%q) = %q, want %q", input, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSanitizeFolderNameNearlyReserved(t *testing.T) {
+	for _, name := range []string{"COM0", "COM10", "LPT0", "CONSOLE", "NULL", "AUXILIARY", "PRN_"} {
+		if got := sanitizeFolderName(name); got != name {
+			t.Errorf("sanitizeFolderName(%q) = %q, want it unchanged", name, got)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package generator
+
+import "context"
+
+// Generation is one JSON/YAML input pair and the directory its structure is written to.
+// JSONData and YAMLData, when set, are read instead of the files or the -json-env and
+// -yaml-env variables, for inputs such as fixtures embedded with go:embed; JSON and YAML then
+// only name them in messages, and the YAML's directory still resolves thresholdsFile
+// references, from the working directory when it is empty.
+type Generation struct {
+	JSON     string `yaml:"json"`
+	YAML     string `yaml:"yaml"`
+	Out      string `yaml:"out"`
+	JSONData []byte `yaml:"-"`
+	YAMLData []byte `yaml:"-"`
+}
+
+// GenerateFromBytes writes the monitoring structure for in-memory JSON and YAML inputs under
+// basePath, with DefaultOptions and without progress or success output. Warnings are logged
+// rather than returned.
+func GenerateFromBytes(jsonData, yamlData []byte, basePath string) error {
+	opts := DefaultOptions()
+	opts.Quiet = true
+	gen := Generation{JSONData: jsonData, YAMLData: yamlData, Out: basePath}
+	return Run(context.Background(), gen, opts, &GenerationStats{})
+}
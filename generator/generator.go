@@ -0,0 +1,2219 @@
+package generator
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// JSON structures remain unchanged
+type Response struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+	Data    Data   `json:"data"`
+}
+
+type Data struct {
+	Containers []Container `json:"containers"`
+}
+
+type Container struct {
+	ParentEntityID string  `json:"parent_entity_id"`
+	ContainerName  string  `json:"container_name"`
+	Graphs         []Graph `json:"graphs"`
+	// Extra holds any other fields on the container, such as team or tier
+	Extra map[string]interface{} `json:"-"`
+}
+
+// UnmarshalJSON decodes the known container fields and keeps the rest in Extra
+func (c *Container) UnmarshalJSON(data []byte) error {
+	type plainContainer Container
+	if err := json.Unmarshal(data, (*plainContainer)(c)); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	delete(fields, "parent_entity_id")
+	delete(fields, "container_name")
+	delete(fields, "graphs")
+
+	c.Extra = nil
+	for key, raw := range fields {
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return err
+		}
+		if c.Extra == nil {
+			c.Extra = make(map[string]interface{}, len(fields))
+		}
+		c.Extra[key] = value
+	}
+	return nil
+}
+
+type Graph struct {
+	GraphName     string      `json:"graph_name"`
+	GraphMetadata []GraphMeta `json:"graph_metadata"`
+}
+
+type GraphMeta struct {
+	LegendName string `json:"legend_name"`
+	EntityID   string `json:"entity_id"`
+	MetricID   string `json:"metric_id"`
+	// DeeplinkID identifies the entity whose layout this metadata opens; nested
+	// containers in MetadataLayout carry it as their ParentEntityID
+	DeeplinkID     string         `json:"deeplink_id"`
+	MetadataLayout MetadataLayout `json:"metadata_layout"`
+}
+
+type MetadataLayout struct {
+	Containers []Container `json:"containers"`
+}
+
+// YAML structures
+type Config struct {
+	Source Source `yaml:"source"`
+}
+
+type Source struct {
+	DefaultConfig DefaultConfig `yaml:"defaultConfig"`
+	Entity        Entity        `yaml:"entity"`
+	// ContainerOverrides replaces notification config names for containers with the given name
+	ContainerOverrides map[string]NotificationOverride `yaml:"containerOverrides,omitempty"`
+	// Metadata carries container fields selected with -passthrough into generated configs
+	Metadata map[string]interface{} `yaml:"metadata,omitempty"`
+}
+
+// NotificationOverride routes a single container's notifications; empty fields keep the default
+type NotificationOverride struct {
+	EmailConfigName string `yaml:"emailConfigName,omitempty"`
+	SlackConfigName string `yaml:"slackConfigName,omitempty"`
+}
+
+type DefaultConfig struct {
+	EmailConfigName            string   `yaml:"emailConfigName"`
+	SlackConfigName            string   `yaml:"slackConfigName,omitempty"`
+	IncidentSevTwoConfigName   string   `yaml:"incidentSevTwoConfigName"`
+	IncidentSevThreeConfigName string   `yaml:"incidentSevThreeConfigName"`
+	IncidentSevFourConfigName  string   `yaml:"incidentSevFourConfigName"`
+	Incident                   Incident `yaml:"incident"`
+	// SeverityMap names the incident config for numeric severities, so sevN uses SeverityMap[N]
+	// ahead of the sev2-4 fields above
+	SeverityMap map[int]string `yaml:"severityMap,omitempty"`
+	// Min and Max are the bounds for thresholds that leave their own unset
+	Min *float64 `yaml:"min,omitempty"`
+	Max *float64 `yaml:"max,omitempty"`
+}
+
+type Incident struct {
+	Severity string `yaml:"severity"`
+	Enabled  bool   `yaml:"enabled"`
+}
+
+// Entity is the monitored entity. Empty ignore and whitelist blocks are left out of generated configs.
+type Entity struct {
+	Name             string            `yaml:"name"`
+	ID               string            `yaml:"id"`
+	Ignore           EntityIDs         `yaml:"ignore,omitempty"`
+	Whitelist        EntityIDs         `yaml:"whitelist,omitempty"`
+	MetricThresholds []MetricThreshold `yaml:"metricThresholds"`
+	// ThresholdsFile names a YAML list of further thresholds, relative to the config's directory
+	ThresholdsFile string `yaml:"thresholdsFile,omitempty"`
+}
+
+// Reports whether the ignore and whitelist blocks keep an entity's graph metadata from
+// matching any threshold: it is ignored, or missing from a non-empty whitelist
+func (e Entity) filtered(entityID string) bool {
+	if containsString(e.Ignore.EntityIds, entityID) {
+		return true
+	}
+	return len(e.Whitelist.EntityIds) > 0 && !containsString(e.Whitelist.EntityIds, entityID)
+}
+
+type EntityIDs struct {
+	EntityIds []string `yaml:"entityIds,omitempty"`
+}
+
+// MetricThreshold bounds one metric. Min and Max are float64, exact only to 15-17 significant
+// digits; integers above 2^53 (9007199254740992) are rounded and reported as warnings.
+type MetricThreshold struct {
+	EntityID       string   `yaml:"entityId" json:"entityId"`
+	MetricID       string   `yaml:"metricId" json:"metricId"`
+	ParentEntityID string   `yaml:"parentEntityId,omitempty" json:"parentEntityId,omitempty"`
+	ContainerName  string   `yaml:"containerName,omitempty" json:"containerName,omitempty"`
+	GraphName      string   `yaml:"graphName,omitempty" json:"graphName,omitempty"`
+	LegendName     string   `yaml:"legendName,omitempty" json:"legendName,omitempty"`
+	Min            *float64 `yaml:"min,omitempty" json:"min,omitempty"`
+	Max            *float64 `yaml:"max,omitempty" json:"max,omitempty"`
+	Incident       string   `yaml:"incident,omitempty" json:"incident,omitempty"`
+	Description    string   `yaml:"description,omitempty" json:"description,omitempty"`
+	// Scale multiplies Min and Max before they are emitted, so bounds can be written in
+	// friendlier units than the metric's, like GB for a metric in bytes
+	Scale *float64 `yaml:"scale,omitempty" json:"scale,omitempty"`
+	// Labels are carried verbatim into generated configs and Prometheus rules
+	Labels map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+	// sourceGraph is the JSON graph the threshold first matched under, kept for -group-by-graph
+	sourceGraph string
+}
+
+// Options controls how the structure is generated
+type Options struct {
+	// Env names an environment subfolder of the output base path
+	Env string
+	// AllowEmptyDefaults skips the required defaultConfig field checks
+	AllowEmptyDefaults bool
+	// Format selects the output: yaml files, a text report or Prometheus rules (yaml/json diff with Baseline)
+	Format string
+	// PromExpr is the text/template for the series selector in -format prom
+	PromExpr string
+	// OutputFile receives single-file formats; empty means stdout
+	OutputFile string
+	// MinCoverage fails the run when a smaller share of the JSON's entity/metric pairs get a threshold
+	MinCoverage float64
+	// WarnDuplicateContainers warns about containers generated at more than one path
+	WarnDuplicateContainers bool
+	// Strict turns threshold conflicts and, with EntityRegistry, unregistered entities into errors
+	Strict bool
+	// EntityRegistry lists the valid entity IDs, one per line; references to any other entity are reported
+	EntityRegistry string
+	// registry holds the IDs loaded from EntityRegistry
+	registry map[string]bool
+	// FailOnWarnings turns any warning into an error before output is written
+	FailOnWarnings bool
+	// CheckParents verifies nested containers' ParentEntityID against their enclosing metadata
+	CheckParents bool
+	// DryRun prints the planned tree instead of writing it
+	DryRun bool
+	// NoColor turns off the dry-run outline's colors even on a terminal
+	NoColor bool
+	// ValidateOnly reports every input problem without generating anything
+	ValidateOnly bool
+	// Audit compares the existing output tree with the one the inputs produce instead of generating
+	Audit bool
+	// Baseline is a directory of previously generated configs to diff against
+	Baseline string
+	// JSONEnv and YAMLEnv name environment variables holding base64-encoded inputs
+	JSONEnv string
+	YAMLEnv string
+	// ChangedFile lists container names, one per line, limiting the run to them and their subtrees
+	ChangedFile string
+	// changed holds the names loaded from ChangedFile
+	changed map[string]bool
+	// Batched leaves the success message and JSON summary to the caller, which reports the
+	// results of several generations together
+	Batched bool
+	// Output receives what the generation prints, os.Stdout when nil. No progress bar is shown
+	// when it is set, so generations running at once can each print to a buffer of their own.
+	Output io.Writer
+	// Only limits the run to containers with these names, excluding their nested containers
+	Only []string
+	// MatchField is what -only and -changed-file entries identify: name or parent-id
+	MatchField string
+	// Stdout writes the single selected container's config to stdout instead of a file
+	Stdout bool
+	// FilenamePrefix is prepended to every generated config's file name, like 10- for 10-config.yaml
+	FilenamePrefix string
+	// LeavesOnly writes config.yaml only for containers without nested containers
+	LeavesOnly bool
+	// StripPrefixes are removed from container names before they become folder names
+	StripPrefixes []string
+	// GroupBy "parent" writes each container's config under a folder named by its ParentEntityID instead of nesting
+	GroupBy string
+	// Inherit cascades each container's thresholds down to its nested containers
+	Inherit bool
+	// Passthrough lists extra container JSON fields copied into each generated config
+	Passthrough []string
+	// Severity, when set, keeps only thresholds whose resolved incident severity matches
+	Severity string
+	// ExcludeMetrics lists metric IDs that never get thresholds
+	ExcludeMetrics []string
+	// Indent is the number of spaces per YAML indentation level
+	Indent int
+	// PreserveOrder processes sibling containers in input order instead of by folder name
+	PreserveOrder bool
+	// SortContainers orders sibling containers by input, name, parent-id or entity-count
+	// instead; empty keeps the folder name order
+	SortContainers string
+	// JSONSummary prints a JSON object of GenerationStats on completion instead of the success message
+	JSONSummary bool
+	// Quiet suppresses progress and success output
+	Quiet bool
+	// DirMode is the permission bits for created directories
+	DirMode octalMode
+	// Owner, when set, is given every directory and config file the writer creates
+	Owner fileOwner
+	// MaxFiles aborts generation when more config files would be written; 0 disables the limit
+	MaxFiles int
+	// WriteRate limits file writes per second; 0 means unlimited
+	WriteRate float64
+	// Archives are zip files that also receive every config written, alongside the output tree
+	Archives []string
+	// Mirrors are further output directories, from repeated -out flags, each written with the
+	// same tree, manifest and bookkeeping files as the generation's own Out
+	Mirrors []string
+	// Retry is how many more times a file write or directory creation is tried after a
+	// transient error, like EIO from a network filesystem
+	Retry int
+	// Timeout bounds the whole run, across every generation; 0 means no limit
+	Timeout time.Duration
+	// Normalize trims surrounding whitespace from the names and IDs of both inputs after parsing
+	Normalize bool
+	// JSONPath is the dotted path to the containers array in the JSON; empty means data.containers
+	JSONPath string
+	// DataField and ContainersField rename the data and containers keys of the JSON envelope
+	// for upstream variants; empty means the standard names
+	DataField       string
+	ContainersField string
+	// GroupByGraph nests each config's thresholds under the JSON graph they matched in
+	GroupByGraph bool
+	// DropEmptyThresholds leaves out thresholds that have neither min nor max once defaults apply
+	DropEmptyThresholds bool
+	// ThresholdScale loosens every emitted bound by this factor, or tightens them below 1; see
+	// loosenedBounds. ThresholdScaleBounds picks the bounds it applies to: both, max or min.
+	ThresholdScale       float64
+	ThresholdScaleBounds string
+	// SortBy orders each config's thresholds: empty keeps match order, severity puts sev2 first
+	SortBy string
+	// NoRecurse generates only the top-level containers; FoldNested also gives them their nested containers' thresholds
+	NoRecurse  bool
+	FoldNested bool
+	// MinGraphs skips containers with fewer graphs than this
+	MinGraphs int
+	// Explain traces one entity=E,metric=M pair through matching instead of generating
+	Explain string
+	// Scaffold prints a starter YAML config for the JSON instead of generating
+	Scaffold bool
+	// ScaffoldWhitelist adds an unbounded placeholder threshold, commented TODO, to each config for
+	// every pair in its container whose entity is whitelisted but which no threshold covers
+	ScaffoldWhitelist bool
+	// Clean removes configs the plan no longer generates; AssumeYes skips its confirmation
+	Clean     bool
+	AssumeYes bool
+	// DedupFiles writes configs shared by several containers once and links them
+	DedupFiles bool
+	// VerifyPaths re-checks the written tree against the plan
+	VerifyPaths bool
+	// GenGitignore writes a .gitignore listing the generated files, from GitignoreTemplate if set
+	GenGitignore      bool
+	GitignoreTemplate string
+	// GenChecksums writes checksums.txt with the SHA-256 of every generated file
+	GenChecksums bool
+	// GenPaths writes generated-paths.txt listing every generated file and directory, as
+	// relative or absolute paths; empty writes nothing
+	GenPaths string
+	// GenIndex writes index.yaml mapping entity IDs to the containers monitoring them
+	GenIndex bool
+	// PostHook is a command run with the output base path after each successful generation
+	PostHook string
+	// MergeThresholds combines thresholds matching the same key, inherited or folded ones included, into the
+	// tightest bounds instead of keeping the first
+	MergeThresholds bool
+	// SourceNames sets each emitted threshold's graph and legend names from the metadata it matched
+	SourceNames bool
+	// DedupKey lists the threshold fields that make two matched thresholds distinct
+	DedupKey dedupKey
+}
+
+// octalMode is a flag.Value holding file permission bits written in octal, like 0755
+type octalMode os.FileMode
+
+func (m *octalMode) String() string {
+	return fmt.Sprintf("%#o", os.FileMode(*m))
+}
+
+func (m *octalMode) Set(value string) error {
+	bits, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || bits > 0777 {
+		return fmt.Errorf("invalid octal permissions %q", value)
+	}
+	*m = octalMode(bits)
+	return nil
+}
+
+// Returns the permission bits as an os.FileMode
+func (m octalMode) mode() os.FileMode {
+	return os.FileMode(m)
+}
+
+// dedupKey is a flag.Value holding the comma-separated threshold fields, like entity,metric,
+// that identify a threshold when deduplicating a container's matches
+type dedupKey []string
+
+// Threshold fields -dedup-key can select
+var dedupKeyFields = map[string]func(MetricThreshold) string{
+	"entity": func(t MetricThreshold) string { return t.EntityID },
+	"metric": func(t MetricThreshold) string { return t.MetricID },
+	"legend": func(t MetricThreshold) string { return t.LegendName },
+	"graph":  func(t MetricThreshold) string { return t.GraphName },
+}
+
+func (k *dedupKey) String() string {
+	return strings.Join(*k, ",")
+}
+
+func (k *dedupKey) Set(value string) error {
+	var fields []string
+	for _, field := range strings.Split(value, ",") {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if _, known := dedupKeyFields[field]; !known {
+			return fmt.Errorf("unknown dedup key field %q (want entity, metric, legend or graph)", field)
+		}
+		fields = append(fields, field)
+	}
+	*k = fields
+	return nil
+}
+
+// Returns the selected fields, or entity and metric when none are
+func (k dedupKey) fields() dedupKey {
+	if len(k) == 0 {
+		return dedupKey{"entity", "metric"}
+	}
+	return k
+}
+
+// Seeds every dedup key hash, so equal keys hash alike for the life of the process
+var dedupSeed = maphash.MakeSeed()
+
+// Hashes the selected fields of a threshold without building a key string. maphash runs as
+// fast as the map's own string hashing, where a byte-at-a-time FNV-1a was several times slower.
+func (k dedupKey) hash(threshold MetricThreshold) uint64 {
+	var hash maphash.Hash
+	hash.SetSeed(dedupSeed)
+	for _, field := range k.fields() {
+		hash.WriteString(dedupKeyFields[field](threshold))
+		// Separate the fields so "ab"+"c" and "a"+"bc" hash differently
+		hash.WriteByte(0xff)
+	}
+	return hash.Sum64()
+}
+
+// Reports whether two thresholds agree on every selected field
+func (k dedupKey) equal(a, b MetricThreshold) bool {
+	for _, field := range k.fields() {
+		if dedupKeyFields[field](a) != dedupKeyFields[field](b) {
+			return false
+		}
+	}
+	return true
+}
+
+// thresholdSet holds thresholds that are unique by a dedup key, in insertion order. They are
+// indexed by the hash of their key fields rather than by a joined key string, which large
+// inputs would otherwise build for every match; thresholds whose hashes collide are told
+// apart by comparing the fields themselves.
+type thresholdSet struct {
+	key dedupKey
+	// byHash holds the first threshold with each hash, so the common case costs no slice;
+	// collisions holds the later ones
+	byHash     map[uint64]int
+	collisions map[uint64][]int
+	thresholds []MetricThreshold
+}
+
+// Creates a set with room for capacity thresholds. Its thresholds slice is never nil, so an
+// empty set still emits an explicit empty list.
+func newThresholdSet(key dedupKey, capacity int) *thresholdSet {
+	return &thresholdSet{key: key, byHash: make(map[uint64]int, capacity), thresholds: make([]MetricThreshold, 0, capacity)}
+}
+
+// Returns the index of the held threshold with the same key as threshold, or -1
+func (s *thresholdSet) index(threshold MetricThreshold) int {
+	hash := s.key.hash(threshold)
+	i, ok := s.byHash[hash]
+	if !ok {
+		return -1
+	}
+	if s.key.equal(s.thresholds[i], threshold) {
+		return i
+	}
+	for _, i := range s.collisions[hash] {
+		if s.key.equal(s.thresholds[i], threshold) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Adds a threshold whose key isn't held yet and returns its index
+func (s *thresholdSet) add(threshold MetricThreshold) int {
+	i := len(s.thresholds)
+	hash := s.key.hash(threshold)
+	if _, taken := s.byHash[hash]; !taken {
+		s.byHash[hash] = i
+	} else {
+		if s.collisions == nil {
+			s.collisions = make(map[uint64][]int)
+		}
+		s.collisions[hash] = append(s.collisions[hash], i)
+	}
+	s.thresholds = append(s.thresholds, threshold)
+	return i
+}
+
+// ContainerConfig is the generated config for one container and where it belongs in the output tree
+type ContainerConfig struct {
+	// Path is the container's directory relative to the output base path
+	Path string
+	// FileName is the config file written in Path
+	FileName  string
+	Container Container
+	Config    Config
+	// Depth is 0 for top-level containers and grows with nesting
+	Depth int
+	// WriteConfig is false for intermediate containers that only get a directory
+	WriteConfig bool
+	// Selected is set for containers named by -changed-file and everything nested under them
+	Selected bool
+	// Conflicts describes entity/metric pairs matched by distinct thresholds, without naming
+	// the container; see conflicts
+	Conflicts []string
+	// Dropped counts the thresholds left out for having neither bound, with -drop-empty-thresholds
+	Dropped int
+}
+
+// Describes the container's conflicts, naming it by its config file as well as its name,
+// since same-named containers are generated at several paths
+func (planned ContainerConfig) conflicts() []string {
+	described := make([]string, len(planned.Conflicts))
+	for i, conflict := range planned.Conflicts {
+		described[i] = fmt.Sprintf("container %q at %s: %s", planned.Container.ContainerName,
+			filepath.ToSlash(filepath.Join(planned.Path, planned.FileName)), conflict)
+	}
+	return described
+}
+
+// Walks the container tree and builds each container's config without touching the filesystem
+func planStructure(containers []Container, yamlConfig Config, opts Options) []ContainerConfig {
+	plan := planContainers("", 0, nil, containers, yamlConfig, opts)
+	if opts.GroupBy == "parent" {
+		plan = groupByParent(plan, opts.FilenamePrefix)
+	}
+	if opts.changed != nil {
+		plan = selectedOnly(plan)
+	}
+	if len(opts.Only) > 0 {
+		plan = onlyNamed(plan, opts)
+	}
+	return plan
+}
+
+// Keeps only the containers named by -only, without their nested containers
+func onlyNamed(plan []ContainerConfig, opts Options) []ContainerConfig {
+	wanted := make(map[string]bool, len(opts.Only))
+	for _, name := range opts.Only {
+		wanted[strings.TrimSpace(name)] = true
+	}
+
+	var kept []ContainerConfig
+	for _, planned := range plan {
+		if wanted[opts.matchKey(planned.Container)] {
+			kept = append(kept, planned)
+		}
+	}
+	return kept
+}
+
+// Returns the value -only and -changed-file entries are compared against: the container's
+// name, or its parent entity ID with -match-field parent-id
+func (opts Options) matchKey(container Container) string {
+	if opts.MatchField == "parent-id" {
+		return strings.TrimSpace(container.ParentEntityID)
+	}
+	return strings.TrimSpace(container.ContainerName)
+}
+
+// Keeps only the selected containers, leaving everything else out of the run
+func selectedOnly(plan []ContainerConfig) []ContainerConfig {
+	var selected []ContainerConfig
+	for _, planned := range plan {
+		if planned.Selected {
+			selected = append(selected, planned)
+		}
+	}
+	return selected
+}
+
+// Flattens a plan into one folder per ParentEntityID, giving each container in a
+// folder its own file named after the container
+func groupByParent(plan []ContainerConfig, prefix string) []ContainerConfig {
+	var grouped []ContainerConfig
+	usedNames := make(map[string]bool)
+	for _, planned := range plan {
+		if !planned.WriteConfig {
+			continue
+		}
+
+		folder := sanitizeFolderName(planned.Container.ParentEntityID)
+		base := prefix + sanitizeFolderName(filepath.Base(planned.Path))
+		fileName := base + ".yaml"
+		for n := 2; usedNames[filepath.Join(folder, fileName)]; n++ {
+			fileName = fmt.Sprintf("%s-%d.yaml", base, n)
+		}
+		usedNames[filepath.Join(folder, fileName)] = true
+
+		planned.Path = folder
+		planned.FileName = fileName
+		planned.Depth = 0
+		grouped = append(grouped, planned)
+	}
+	return grouped
+}
+
+// Returns where the generation prints its output
+func (opts Options) output() io.Writer {
+	if opts.Output == nil {
+		return os.Stdout
+	}
+	return opts.Output
+}
+
+// Returns the name of each container's config file
+func (opts Options) configFileName() string {
+	return opts.FilenamePrefix + "config.yaml"
+}
+
+// Checks that a -filename-prefix keeps file names portable: no separators, no leading dot
+// and nothing but letters, digits, '.', '_' and '-'
+func validFilenamePrefix(prefix string) error {
+	if len(prefix) > 64 {
+		return fmt.Errorf("-filename-prefix must be at most 64 characters")
+	}
+	if strings.HasPrefix(prefix, ".") {
+		return fmt.Errorf("-filename-prefix %q must not start with a dot, which hides the files", prefix)
+	}
+	for _, r := range prefix {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-') {
+			return fmt.Errorf("-filename-prefix %q may only contain letters, digits, '.', '_' and '-'", prefix)
+		}
+	}
+	return nil
+}
+
+// Plans one level of sibling containers below parentPath, followed by their nested containers.
+// inherited holds the parent's thresholds when -inherit is set.
+func planContainers(parentPath string, depth int, inherited []MetricThreshold, containers []Container, yamlConfig Config, opts Options) []ContainerConfig {
+	switch {
+	case opts.SortContainers != "":
+		containers = sortedContainers(containers, opts.SortContainers)
+	case !opts.PreserveOrder:
+		containers = sortedByFolderName(containers, opts)
+	}
+
+	var planned []ContainerConfig
+	for _, container := range containers {
+		sanitizedName := folderName(container.ContainerName, opts)
+		currentPath := filepath.Join(parentPath, sanitizedName)
+
+		containerYaml, conflicts, dropped := createContainerYaml(yamlConfig, container, opts)
+		if opts.Inherit {
+			var merged []string
+			containerYaml.Source.Entity.MetricThresholds, merged = inheritThresholds(containerYaml.Source.Entity.MetricThresholds, inherited, opts)
+			conflicts = append(conflicts, merged...)
+		}
+		if opts.FoldNested {
+			// The nested containers aren't generated, so their thresholds move up into this one
+			var merged []string
+			containerYaml.Source.Entity.MetricThresholds, merged = inheritThresholds(containerYaml.Source.Entity.MetricThresholds, nestedThresholds(container, yamlConfig, opts), opts)
+			conflicts = append(conflicts, merged...)
+		}
+		// Nested containers inherit only real thresholds, not this container's placeholders
+		matched := containerYaml.Source.Entity.MetricThresholds
+		if opts.ScaffoldWhitelist {
+			containerYaml.Source.Entity.MetricThresholds = append(matched[:len(matched):len(matched)], whitelistPlaceholders(container, yamlConfig, matched, opts)...)
+		}
+		if opts.SortBy == "severity" {
+			sortBySeverity(containerYaml.Source.Entity.MetricThresholds, yamlConfig.Source.DefaultConfig)
+		}
+
+		selected := opts.changed[opts.matchKey(container)]
+
+		// Process nested containers
+		var children []ContainerConfig
+		if nested := nestedContainers(container); len(nested) > 0 && !opts.NoRecurse {
+			children = planContainers(currentPath, depth+1, matched, nested, yamlConfig, opts)
+			if selected {
+				// A changed container regenerates its whole subtree
+				for i := range children {
+					children[i].Selected = true
+				}
+			}
+		}
+
+		// Containers with too few graphs get no config, and no directory unless a nested container needs one
+		sparse := len(container.Graphs) < opts.MinGraphs
+		if sparse && len(children) == 0 {
+			continue
+		}
+
+		planned = append(planned, ContainerConfig{
+			Path:      currentPath,
+			FileName:  opts.configFileName(),
+			Depth:     depth,
+			Container: container,
+			Config:    containerYaml,
+			// Intermediate containers only get a directory when writing leaves only
+			// Without recursion every container generated is a leaf of the output tree
+			WriteConfig: !sparse && (!opts.LeavesOnly || opts.NoRecurse || isLeafContainer(container)),
+			Selected:    selected,
+			Conflicts:   conflicts,
+			Dropped:     dropped,
+		})
+		planned = append(planned, children...)
+	}
+	return planned
+}
+
+// Function to create directory structure and generate YAML files through w;
+// stats receives the counts of what was written.
+func createStructureAndYaml(ctx context.Context, w Writer, plan []ContainerConfig, opts Options, stats *GenerationStats) error {
+	// Throttle writes so bursts don't overwhelm network filesystems
+	var throttle <-chan time.Time
+	if opts.WriteRate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / opts.WriteRate))
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+
+	if err := checkMaxFiles(plan, opts.MaxFiles); err != nil {
+		return err
+	}
+	progress := newProgress(countTopLevel(plan), opts.Quiet || opts.Output != nil)
+	defer progress.finish()
+
+	dirs, _ := w.(dirWriter)
+	written := 0
+	for _, planned := range plan {
+		if ctx.Err() != nil {
+			return fmt.Errorf("timed out after writing %d of %d config files", written, countConfigFiles(plan))
+		}
+		if planned.Depth == 0 {
+			progress.startTopLevel()
+		}
+		if !withinBase(planned.Path) {
+			return fmt.Errorf("refusing to write %s outside the output directory", planned.Path)
+		}
+
+		if dirs != nil {
+			if err := dirs.MkdirAll(planned.Path); err != nil {
+				return err
+			}
+		}
+
+		if !planned.WriteConfig {
+			continue
+		}
+
+		// Create YAML file for this container
+		yamlData, err := marshalConfig(planned.Config, opts.configStyle())
+		if err != nil {
+			return fmt.Errorf("error marshaling YAML for %s: %v", planned.Container.ContainerName, err)
+		}
+
+		if throttle != nil {
+			select {
+			case <-throttle:
+			case <-ctx.Done():
+				return fmt.Errorf("timed out after writing %d of %d config files", written, countConfigFiles(plan))
+			}
+		}
+
+		yamlPath := filepath.Join(planned.Path, planned.FileName)
+		if err := w.WriteConfig(yamlPath, yamlData); errors.Is(err, errSkipped) {
+			stats.addSkipped()
+			continue
+		} else if err != nil {
+			return err
+		}
+		written++
+		stats.addConfigFile(len(planned.Config.Source.Entity.MetricThresholds))
+		logger.Debug("wrote config",
+			"container", planned.Container.ContainerName,
+			"path", yamlPath,
+			"thresholds", len(planned.Config.Source.Entity.MetricThresholds))
+	}
+	progress.complete()
+	return nil
+}
+
+// Reports whether a planned path relative to the output base stays inside it. Sanitized
+// names can't escape it; this guards against any future naming change that could.
+func withinBase(path string) bool {
+	clean := filepath.Clean(path)
+	return !filepath.IsAbs(clean) && clean != ".." && !strings.HasPrefix(clean, ".."+string(filepath.Separator))
+}
+
+// Names the marker that makes an existing config hand-maintained, or returns "" when it may be
+// regenerated. A .skip file in the directory or a "# generated: false" comment line in the
+// config itself takes precedence over every selection flag; the file is never rewritten.
+func manualOverride(dir, fileName string) string {
+	if _, err := os.Stat(filepath.Join(dir, ".skip")); err == nil {
+		return ".skip"
+	}
+	file, err := os.Open(filepath.Join(dir, fileName))
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") && strings.TrimSpace(strings.TrimPrefix(line, "#")) == "generated: false" {
+			return "# generated: false"
+		}
+	}
+	return ""
+}
+
+// Orders thresholds sev2 first, then sev3, sev4 and those without a resolved severity,
+// breaking ties by entity and metric ID
+func sortBySeverity(thresholds []MetricThreshold, defaults DefaultConfig) {
+	rank := func(threshold MetricThreshold) int {
+		return severityRank(resolvedSeverity(threshold, defaults))
+	}
+	sort.SliceStable(thresholds, func(i, j int) bool {
+		a, b := thresholds[i], thresholds[j]
+		if rank(a) != rank(b) {
+			return rank(a) < rank(b)
+		}
+		if a.EntityID != b.EntityID {
+			return a.EntityID < b.EntityID
+		}
+		return a.MetricID < b.MetricID
+	})
+}
+
+// Ranks a severity from most severe: sevN ranks N, and no or another severity ranks after all of them
+func severityRank(severity string) int {
+	if level, ok := severityLevel(severity); ok {
+		return level
+	}
+	return maxSeverityLevel + 1
+}
+
+// Combines two thresholds for the same entity/metric into the tightest: the larger min, the
+// smaller max and the more severe incident. An unset bound leaves the other's in place.
+func mergeThresholds(a, b MetricThreshold) MetricThreshold {
+	merged := a
+	if b.Min != nil && (merged.Min == nil || *b.Min > *merged.Min) {
+		merged.Min = b.Min
+	}
+	if b.Max != nil && (merged.Max == nil || *b.Max < *merged.Max) {
+		merged.Max = b.Max
+	}
+	if severityRank(b.Incident) < severityRank(merged.Incident) {
+		merged.Incident = b.Incident
+	}
+	return merged
+}
+
+// Adds the inherited thresholds, a parent's or the nested containers', whose -dedup-key the
+// container doesn't match itself. With -merge-thresholds one it does match is merged into the
+// container's own instead, so a definition split between the two comes out as one threshold;
+// merges that leave min above max are described in the returned conflicts.
+func inheritThresholds(own, inherited []MetricThreshold, opts Options) ([]MetricThreshold, []string) {
+	set := newThresholdSet(opts.DedupKey, len(own)+len(inherited))
+	for _, threshold := range own {
+		set.add(threshold)
+	}
+	var conflicts []string
+	reported := make(map[int]bool)
+	for _, threshold := range inherited {
+		held := set.index(threshold)
+		switch {
+		case held < 0:
+			set.add(threshold)
+		case opts.MergeThresholds:
+			merged := mergeThresholds(set.thresholds[held], threshold)
+			set.thresholds[held] = merged
+			if merged.Min != nil && merged.Max != nil && *merged.Min > *merged.Max && !reported[held] {
+				reported[held] = true
+				conflicts = append(conflicts, fmt.Sprintf("entityId %q metricId %q merges with inherited thresholds to min %s above max %s",
+					threshold.EntityID, threshold.MetricID, formatBound(merged.Min), formatBound(merged.Max)))
+			}
+		}
+	}
+	return set.thresholds, conflicts
+}
+
+// Collects the thresholds of every container nested under container, depth first, for -fold-nested
+func nestedThresholds(container Container, yamlConfig Config, opts Options) []MetricThreshold {
+	var thresholds []MetricThreshold
+	for _, nested := range nestedContainers(container) {
+		nestedYaml, _, _ := createContainerYaml(yamlConfig, nested, opts)
+		thresholds = append(thresholds, nestedYaml.Source.Entity.MetricThresholds...)
+		thresholds = append(thresholds, nestedThresholds(nested, yamlConfig, opts)...)
+	}
+	return thresholds
+}
+
+// Wraps a filesystem error, spelling out permission problems so operators know what to fix
+func describeFSError(action, path string, err error) error {
+	if errors.Is(err, fs.ErrPermission) {
+		return fmt.Errorf("permission denied %s %s while running as uid %d: check that this user can write to the output directory, or adjust -dir-mode if directories are created without write access (%v)", action, path, os.Geteuid(), err)
+	}
+	return fmt.Errorf("error %s %s: %v", action, path, err)
+}
+
+// Counts the top-level containers in a plan
+func countTopLevel(plan []ContainerConfig) int {
+	topLevel := 0
+	for _, planned := range plan {
+		if planned.Depth == 0 {
+			topLevel++
+		}
+	}
+	return topLevel
+}
+
+// Refuses runaway inputs before anything is written, so there is nothing to clean up
+func checkMaxFiles(plan []ContainerConfig, maxFiles int) error {
+	if maxFiles > 0 {
+		if files := countConfigFiles(plan); files > maxFiles {
+			return fmt.Errorf("generation would write %d files, more than the -max-files limit of %d", files, maxFiles)
+		}
+	}
+	return nil
+}
+
+// Counts the config files a plan would write
+func countConfigFiles(plan []ContainerConfig) int {
+	files := 0
+	for _, planned := range plan {
+		if planned.WriteConfig {
+			files++
+		}
+	}
+	return files
+}
+
+// Returns a copy of sibling containers ordered by folder name, keeping input order for ties
+func sortedByFolderName(containers []Container, opts Options) []Container {
+	sorted := make([]Container, len(containers))
+	copy(sorted, containers)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return folderName(sorted[i].ContainerName, opts) < folderName(sorted[j].ContainerName, opts)
+	})
+	return sorted
+}
+
+// Returns a copy of sibling containers ordered by the -sort-containers key, keeping input
+// order for ties
+func sortedContainers(containers []Container, by string) []Container {
+	sorted := make([]Container, len(containers))
+	copy(sorted, containers)
+	switch by {
+	case "name":
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].ContainerName < sorted[j].ContainerName
+		})
+	case "parent-id":
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].ParentEntityID < sorted[j].ParentEntityID
+		})
+	case "entity-count":
+		// Counted once per container up front rather than on every comparison, sorting the
+		// input indexes so each count stays with its container
+		counts := make([]int, len(containers))
+		order := make([]int, len(containers))
+		for i, container := range containers {
+			counts[i] = entityCount(container)
+			order[i] = i
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			return counts[order[i]] > counts[order[j]]
+		})
+		for i, index := range order {
+			sorted[i] = containers[index]
+		}
+	}
+	return sorted
+}
+
+// Counts the distinct entity IDs in a container's own graph metadata
+func entityCount(container Container) int {
+	entities := make(map[string]bool)
+	for _, graph := range container.Graphs {
+		for _, meta := range graph.GraphMetadata {
+			entities[meta.EntityID] = true
+		}
+	}
+	return len(entities)
+}
+
+// Collects the containers nested under a container's graph metadata layouts, in order.
+// Containers with null graphs, graphs with null metadata and metadata without a layout
+// simply contribute nothing.
+func nestedContainers(container Container) []Container {
+	var nested []Container
+	for _, graph := range container.Graphs {
+		if graph.GraphMetadata == nil {
+			continue
+		}
+		for _, meta := range graph.GraphMetadata {
+			if meta.MetadataLayout.Containers == nil {
+				continue
+			}
+			nested = append(nested, meta.MetadataLayout.Containers...)
+		}
+	}
+	return nested
+}
+
+// Reports whether a container has no nested containers in any of its graph metadata
+func isLeafContainer(container Container) bool {
+	return len(nestedContainers(container)) == 0
+}
+
+// Creates a YAML configuration tailored to a specific container. It also returns a
+// description of every conflict: distinct thresholds applying to the same entity/metric,
+// and the number of thresholds dropped by -drop-empty-thresholds.
+func createContainerYaml(config Config, container Container, opts Options) (Config, []string, int) {
+	newConfig := Config{
+		Source: Source{
+			DefaultConfig: config.Source.DefaultConfig,
+			Entity: Entity{
+				Name:      config.Source.Entity.Name,
+				ID:        config.Source.Entity.ID,
+				Ignore:    config.Source.Entity.Ignore,
+				Whitelist: config.Source.Entity.Whitelist,
+			},
+		},
+	}
+
+	// Route this container's notifications to its own channels when overridden
+	if override, exists := config.Source.ContainerOverrides[container.ContainerName]; exists {
+		if override.EmailConfigName != "" {
+			newConfig.Source.DefaultConfig.EmailConfigName = override.EmailConfigName
+		}
+		if override.SlackConfigName != "" {
+			newConfig.Source.DefaultConfig.SlackConfigName = override.SlackConfigName
+		}
+	}
+
+	// Carry selected container metadata over verbatim
+	for _, key := range opts.Passthrough {
+		if value, exists := container.Extra[key]; exists {
+			if newConfig.Source.Metadata == nil {
+				newConfig.Source.Metadata = make(map[string]interface{})
+			}
+			newConfig.Source.Metadata[key] = value
+		}
+	}
+
+	// Deduplicate on the -dedup-key fields, entityId and metricId by default, keeping first-seen
+	// order. Sized for one threshold per graph metadata, which the default key can't exceed.
+	metas := 0
+	for _, graph := range container.Graphs {
+		metas += len(graph.GraphMetadata)
+	}
+	unique := newThresholdSet(opts.DedupKey, metas)
+	var conflicts []string
+	reported := make(map[int]bool)
+	placeholders := newThresholdSet(opts.DedupKey, 0)
+	add := func(threshold MetricThreshold) {
+		if opts.Severity != "" && resolvedSeverity(threshold, config.Source.DefaultConfig) != normalizeSeverity(opts.Severity) {
+			return
+		}
+		threshold = loosenedBounds(resolvedBounds(threshold, config.Source.DefaultConfig), opts.ThresholdScale, opts.ThresholdScaleBounds)
+		if opts.DropEmptyThresholds && threshold.Min == nil && threshold.Max == nil {
+			// Dropped before deduplication, so a placeholder never shadows a real threshold
+			if placeholders.index(threshold) < 0 {
+				placeholders.add(threshold)
+			}
+			return
+		}
+
+		// Only add if this unique combination of key fields has not been added before
+		held := unique.index(threshold)
+		if held < 0 {
+			unique.add(threshold)
+			return
+		}
+		existing := unique.thresholds[held]
+		if opts.MergeThresholds {
+			merged := mergeThresholds(existing, threshold)
+			unique.thresholds[held] = merged
+			if merged.Min != nil && merged.Max != nil && *merged.Min > *merged.Max && !reported[held] {
+				reported[held] = true
+				conflicts = append(conflicts, fmt.Sprintf("entityId %q metricId %q merges to min %s above max %s",
+					threshold.EntityID, threshold.MetricID, formatBound(merged.Min), formatBound(merged.Max)))
+			}
+		} else if !sameBounds(existing, threshold) && !reported[held] {
+			reported[held] = true
+			conflicts = append(conflicts, fmt.Sprintf("entityId %q metricId %q has conflicting thresholds (%s vs %s); keeping the first",
+				threshold.EntityID, threshold.MetricID, describeBounds(existing), describeBounds(threshold)))
+		}
+	}
+
+	// Every specific match, including those -severity or -drop-empty-thresholds leave out, so
+	// no graph-level threshold stands in for them. Metas of excluded metrics, and of entities
+	// the ignore and whitelist blocks filter out, get no threshold at all.
+	specific := newThresholdSet(opts.DedupKey, metas)
+	for _, graph := range container.Graphs {
+		for _, meta := range graph.GraphMetadata {
+			if opts.metricExcluded(meta.MetricID) || config.Source.Entity.filtered(meta.EntityID) {
+				continue
+			}
+			for _, threshold := range config.Source.Entity.MetricThresholds {
+				if threshold.EntityID == meta.EntityID && threshold.MetricID == meta.MetricID {
+					threshold = withSourceNames(threshold, graph, meta, opts)
+					if specific.index(threshold) < 0 {
+						specific.add(threshold)
+					}
+					add(threshold)
+				}
+			}
+		}
+	}
+
+	// Graph-level thresholds are fallbacks for the remaining metas of graphs with their name:
+	// a specific entity/metric threshold anywhere in the container replaces them outright, so
+	// they are never merged into one or reported as conflicting with it, and the first
+	// fallback for a key wins over later ones
+	fallbacks := newThresholdSet(opts.DedupKey, 0)
+	for _, graph := range container.Graphs {
+		for _, meta := range graph.GraphMetadata {
+			if opts.metricExcluded(meta.MetricID) || config.Source.Entity.filtered(meta.EntityID) {
+				continue
+			}
+			for _, threshold := range config.Source.Entity.MetricThresholds {
+				if isGraphLevel(threshold) && threshold.GraphName == graph.GraphName {
+					threshold.EntityID = meta.EntityID
+					threshold.MetricID = meta.MetricID
+					threshold = withSourceNames(threshold, graph, meta, opts)
+					if specific.index(threshold) >= 0 || fallbacks.index(threshold) >= 0 {
+						continue
+					}
+					fallbacks.add(threshold)
+					add(threshold)
+				}
+			}
+		}
+	}
+
+	// Never nil, so containers without graphs or metadata still get an explicit empty list
+	newConfig.Source.Entity.MetricThresholds = unique.thresholds
+
+	// Only placeholders with no real threshold for their key would have been emitted
+	dropped := 0
+	for _, placeholder := range placeholders.thresholds {
+		if unique.index(placeholder) < 0 {
+			dropped++
+		}
+	}
+	return newConfig, conflicts, dropped
+}
+
+// Records the graph and legend a threshold matched under, with -source-names, so the
+// output maps back to the dashboard rather than repeating whatever the YAML said. With
+// -group-by-graph the graph is also kept for grouping.
+func withSourceNames(threshold MetricThreshold, graph Graph, meta GraphMeta, opts Options) MetricThreshold {
+	if opts.GroupByGraph {
+		threshold.sourceGraph = graph.GraphName
+	}
+	if opts.SourceNames {
+		threshold.GraphName = graph.GraphName
+		threshold.LegendName = meta.LegendName
+	}
+	return threshold
+}
+
+// Reports whether two thresholds would alert identically
+func sameBounds(a, b MetricThreshold) bool {
+	return formatBound(a.Min) == formatBound(b.Min) &&
+		formatBound(a.Max) == formatBound(b.Max) &&
+		normalizeSeverity(a.Incident) == normalizeSeverity(b.Incident)
+}
+
+// Summarizes a threshold's bounds and incident for messages
+func describeBounds(threshold MetricThreshold) string {
+	return fmt.Sprintf("min %s, max %s, incident %s", formatBound(threshold.Min), formatBound(threshold.Max), orDash(normalizeSeverity(threshold.Incident)))
+}
+
+// Reports whether a metric ID was globally excluded from matching
+func (opts Options) metricExcluded(metricID string) bool {
+	for _, excluded := range opts.ExcludeMetrics {
+		if excluded == metricID {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolves a threshold's incident severity: its own incident, else the default
+// severity when incidents are enabled by default. Empty means no severity.
+func resolvedSeverity(threshold MetricThreshold, defaults DefaultConfig) string {
+	if severity := normalizeSeverity(threshold.Incident); severity != "" {
+		return severity
+	}
+	if defaults.Incident.Enabled {
+		return normalizeSeverity(defaults.Incident.Severity)
+	}
+	return ""
+}
+
+// Resolves the bounds a threshold is emitted with: its own min and max multiplied by its
+// scale, which is then dropped, and unset ones filled from the defaultConfig bounds, which
+// are already in output units
+func resolvedBounds(threshold MetricThreshold, defaults DefaultConfig) MetricThreshold {
+	if threshold.Scale != nil {
+		threshold.Min = scaledBound(threshold.Min, *threshold.Scale)
+		threshold.Max = scaledBound(threshold.Max, *threshold.Scale)
+		threshold.Scale = nil
+	}
+	if threshold.Min == nil {
+		threshold.Min = defaults.Min
+	}
+	if threshold.Max == nil {
+		threshold.Max = defaults.Max
+	}
+	return threshold
+}
+
+// Multiplies an optional bound by factor
+func scaledBound(bound *float64, factor float64) *float64 {
+	if bound == nil {
+		return nil
+	}
+	scaled := *bound * factor
+	return &scaled
+}
+
+// Applies -threshold-scale to resolved bounds. A factor f moves each bound f times further
+// out: a max of m becomes m*f when m >= 0 and m/f when m < 0, and a min of m becomes m/f
+// when m >= 0 and m*f when m < 0. A factor below 1 therefore tightens, and zero bounds stay
+// put. which is both, or max or min to move only that bound.
+func loosenedBounds(threshold MetricThreshold, factor float64, which string) MetricThreshold {
+	if factor == 1 {
+		return threshold
+	}
+	outward := func(bound *float64, up bool) *float64 {
+		if bound == nil {
+			return nil
+		}
+		moved := *bound * factor
+		if (*bound >= 0) != up {
+			moved = *bound / factor
+		}
+		return &moved
+	}
+	if which != "min" {
+		threshold.Max = outward(threshold.Max, true)
+	}
+	if which != "max" {
+		threshold.Min = outward(threshold.Min, false)
+	}
+	return threshold
+}
+
+// Reports whether a threshold applies to every metric of a named graph rather than one entity/metric
+func isGraphLevel(threshold MetricThreshold) bool {
+	return threshold.EntityID == "" && threshold.MetricID == "" && threshold.GraphName != ""
+}
+
+// Identifies a threshold by its entityId and metricId combination
+func thresholdKey(threshold MetricThreshold) string {
+	return threshold.EntityID + "-" + threshold.MetricID
+}
+
+// configStyle holds the settings that shape a generated config's YAML beyond its contents
+type configStyle struct {
+	// indent is the number of spaces per indentation level
+	indent int
+	// groupByGraph nests the thresholds under their source graphs, for -group-by-graph
+	groupByGraph bool
+}
+
+// Returns the style the generated configs are marshaled in
+func (opts Options) configStyle() configStyle {
+	return configStyle{indent: opts.Indent, groupByGraph: opts.GroupByGraph}
+}
+
+// Marshals a generated config in style, emitting each threshold's description as a comment
+// above it
+func marshalConfig(config Config, style configStyle) ([]byte, error) {
+	// Descriptions are carried as comments rather than fields, so strip them before marshaling
+	thresholds := config.Source.Entity.MetricThresholds
+	descriptions := make([]string, len(thresholds))
+	stripped := make([]MetricThreshold, len(thresholds))
+	for i, threshold := range thresholds {
+		descriptions[i] = threshold.Description
+		threshold.Description = ""
+		stripped[i] = threshold
+	}
+	config.Source.Entity.MetricThresholds = stripped
+	if style.groupByGraph {
+		return encodeGroupedByGraph(config, descriptions, style.indent)
+	}
+
+	data, err := encodeYAML(config, style.indent)
+	if err != nil {
+		return nil, err
+	}
+	return normalizeNewlines(annotateThresholds(data, descriptions)), nil
+}
+
+// Encodes a config with its metricThresholds list replaced by graphs, mapping each source
+// graph name to {thresholds: [...]} in first-match order, for -group-by-graph. Descriptions
+// become comments above their thresholds, as in the flat shape.
+func encodeGroupedByGraph(config Config, descriptions []string, indent int) ([]byte, error) {
+	scalar := func(value string) *yaml.Node {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+	}
+	graphs := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	sequences := make(map[string]*yaml.Node)
+	for i, threshold := range config.Source.Entity.MetricThresholds {
+		sequence, exists := sequences[threshold.sourceGraph]
+		if !exists {
+			sequence = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+			sequences[threshold.sourceGraph] = sequence
+			graphs.Content = append(graphs.Content, scalar(threshold.sourceGraph),
+				&yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{scalar("thresholds"), sequence}})
+		}
+		var item yaml.Node
+		if err := item.Encode(threshold); err != nil {
+			return nil, err
+		}
+		item.HeadComment = strings.TrimRight(descriptions[i], "\n")
+		sequence.Content = append(sequence.Content, &item)
+	}
+
+	var doc yaml.Node
+	if err := doc.Encode(config); err != nil {
+		return nil, err
+	}
+	entity := mappingValue(mappingValue(&doc, "source"), "entity")
+	for i := 0; i+1 < len(entity.Content); i += 2 {
+		if entity.Content[i].Value == "metricThresholds" {
+			entity.Content[i].Value = "graphs"
+			entity.Content[i+1] = graphs
+		}
+	}
+	return encodeYAML(&doc, indent)
+}
+
+// Encodes a value as YAML using the given number of spaces per indentation level. Sequences
+// in mappings start at their key's indentation, as yaml.v2 wrote them.
+func encodeYAML(value interface{}, indent int) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(indent)
+	encoder.CompactSeqIndent()
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return normalizeNewlines(buf.Bytes()), nil
+}
+
+// Converts CRLF and lone CR line endings to LF and makes data end with exactly one newline,
+// as linters and editorconfig rules expect on every OS
+func normalizeNewlines(data []byte) []byte {
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	data = bytes.ReplaceAll(data, []byte("\r"), []byte("\n"))
+	data = bytes.TrimRight(data, "\n")
+	if len(data) == 0 {
+		return data
+	}
+	return append(data, '\n')
+}
+
+// Inserts descriptions as leading comments above the matching metricThresholds list items.
+// descriptions is indexed by the position of the threshold in the marshaled list.
+func annotateThresholds(data []byte, descriptions []string) []byte {
+	hasDescription := false
+	for _, description := range descriptions {
+		if description != "" {
+			hasDescription = true
+			break
+		}
+	}
+	if !hasDescription {
+		return data
+	}
+
+	lines := strings.Split(string(data), "\n")
+	result := make([]string, 0, len(lines)+len(descriptions))
+	keyIndent, itemIndent := -1, -1
+	index := 0
+
+	for _, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		indent := len(line) - len(trimmed)
+
+		if keyIndent >= 0 && trimmed != "" {
+			if itemIndent < 0 && strings.HasPrefix(trimmed, "- ") && indent >= keyIndent {
+				itemIndent = indent
+			}
+			if indent == itemIndent && strings.HasPrefix(trimmed, "- ") {
+				if index < len(descriptions) && descriptions[index] != "" {
+					prefix := strings.Repeat(" ", indent) + "# "
+					for _, commentLine := range strings.Split(strings.TrimRight(descriptions[index], "\n"), "\n") {
+						result = append(result, strings.TrimRight(prefix+commentLine, " "))
+					}
+				}
+				index++
+			} else if indent < itemIndent || itemIndent < 0 || (indent == itemIndent && !strings.HasPrefix(trimmed, "- ")) {
+				// Left the metricThresholds block
+				keyIndent, itemIndent = -1, -1
+			}
+		}
+
+		if keyIndent < 0 && trimmed == "metricThresholds:" {
+			keyIndent = indent
+		}
+		result = append(result, line)
+	}
+	return []byte(strings.Join(result, "\n"))
+}
+
+// Builds the folder name for a container, stripping configured prefixes before sanitizing
+func folderName(containerName string, opts Options) string {
+	name := containerName
+	for _, prefix := range opts.StripPrefixes {
+		name = strings.TrimPrefix(name, prefix)
+	}
+	return sanitizeFolderName(name)
+}
+
+// Sanitizes folder names to ensure compatibility with file system restrictions
+func sanitizeFolderName(name string) string {
+	invalid := []string{"/", "\\", ":", "*", "?", "\"", "<", ">", "|"}
+	result := name
+	for _, char := range invalid {
+		result = strings.ReplaceAll(result, char, "_")
+	}
+	// Control characters, NUL especially, are rejected or mangled by most filesystems
+	result = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return '_'
+		}
+		return r
+	}, result)
+	// An empty name would put the container's config in its parent's directory
+	if result == "" {
+		return "_"
+	}
+	// "." and ".." would resolve to the parent or above and escape the output tree
+	if strings.Trim(result, ".") == "" {
+		return strings.Repeat("_", len(result))
+	}
+
+	// Windows reserves device names even with an extension, so suffix the part before the first dot
+	base, extension := result, ""
+	if dot := strings.Index(result, "."); dot >= 0 {
+		base, extension = result[:dot], result[dot:]
+	}
+	if windowsReservedNames[strings.ToUpper(base)] {
+		result = base + "_" + extension
+	}
+	return result
+}
+
+// Device names Windows refuses as file or directory names, in upper case
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// DefaultOptions returns the options a generation starts from, which the command line has
+// when no flags are given
+func DefaultOptions() Options {
+	return Options{
+		Normalize:            true,
+		MatchField:           "name",
+		DedupKey:             dedupKey{"entity", "metric"},
+		ThresholdScale:       1,
+		ThresholdScaleBounds: "both",
+		Indent:               2,
+		DirMode:              0755,
+		MaxFiles:             100000,
+		Format:               "yaml",
+		PromExpr:             defaultPromExpr,
+	}
+}
+
+// Validate checks the option values that don't depend on the inputs
+func (opts Options) Validate() error {
+	if opts.WriteRate < 0 {
+		return fmt.Errorf("-write-rate must not be negative")
+	}
+	if opts.Retry < 0 {
+		return fmt.Errorf("-retry must not be negative")
+	}
+	if opts.Timeout < 0 {
+		return fmt.Errorf("-timeout must not be negative")
+	}
+	if !(opts.ThresholdScale > 0) || math.IsInf(opts.ThresholdScale, 1) {
+		return fmt.Errorf("-threshold-scale must be a positive, finite factor")
+	}
+	if opts.ThresholdScaleBounds != "both" && opts.ThresholdScaleBounds != "max" && opts.ThresholdScaleBounds != "min" {
+		return fmt.Errorf("-threshold-scale-bounds must be both, max or min, not %q", opts.ThresholdScaleBounds)
+	}
+	if opts.MinCoverage < 0 || opts.MinCoverage > 1 {
+		return fmt.Errorf("-min-coverage must be between 0 and 1")
+	}
+	if opts.MinGraphs < 0 {
+		return fmt.Errorf("-min-graphs must not be negative")
+	}
+	if opts.MaxFiles < 0 {
+		return fmt.Errorf("-max-files must not be negative")
+	}
+	if opts.Stdout && (opts.Format != "yaml" || opts.DryRun || opts.Baseline != "") {
+		return fmt.Errorf("-stdout writes a single YAML config and can't be combined with -format, -dry-run or -baseline")
+	}
+	if opts.Scaffold && (opts.Format != "yaml" || opts.DryRun || opts.ValidateOnly || opts.Baseline != "" || opts.Stdout) {
+		return fmt.Errorf("-scaffold prints a YAML template and can't be combined with -format, -dry-run, -validate-only, -baseline or -stdout")
+	}
+	if opts.Clean && (opts.ChangedFile != "" || len(opts.Only) > 0) {
+		return fmt.Errorf("-clean needs a full generation and can't be combined with -changed-file or -only")
+	}
+	if opts.JSONPath != "" && (opts.DataField != "" || opts.ContainersField != "") {
+		return fmt.Errorf("-json-path gives the full path to the containers and can't be combined with -data-field or -containers-field")
+	}
+	if len(opts.Archives) > 0 && (opts.DryRun || opts.ValidateOnly || opts.Baseline != "" || opts.Stdout || opts.Audit || opts.Scaffold || opts.Explain != "") {
+		return fmt.Errorf("-archive only applies when writing the output tree, not with -dry-run, -validate-only, -baseline, -stdout, -audit, -scaffold or -explain")
+	}
+	if len(opts.Mirrors) > 0 && (opts.DryRun || opts.ValidateOnly || opts.Baseline != "" || opts.Stdout || opts.Audit || opts.Scaffold || opts.Explain != "") {
+		return fmt.Errorf("a repeated -out only applies when writing the output tree, not with -dry-run, -validate-only, -baseline, -stdout, -audit, -scaffold or -explain")
+	}
+	if opts.Audit && (opts.DryRun || opts.ValidateOnly || opts.Baseline != "" || opts.Stdout || opts.Scaffold || opts.Explain != "") {
+		return fmt.Errorf("-audit can't be combined with -dry-run, -validate-only, -baseline, -stdout, -scaffold or -explain")
+	}
+	if opts.Audit && (opts.ChangedFile != "" || len(opts.Only) > 0) {
+		return fmt.Errorf("-audit checks the whole tree and can't be combined with -changed-file or -only")
+	}
+	if opts.FoldNested && !opts.NoRecurse {
+		return fmt.Errorf("-fold-nested only applies with -no-recurse")
+	}
+	if opts.MatchField != "" && opts.MatchField != "name" && opts.MatchField != "parent-id" {
+		return fmt.Errorf("unknown -match-field %q", opts.MatchField)
+	}
+	switch opts.SortContainers {
+	case "", "input", "name", "parent-id", "entity-count":
+	default:
+		return fmt.Errorf("unknown -sort-containers %q", opts.SortContainers)
+	}
+	if opts.SortContainers != "" && opts.PreserveOrder {
+		return fmt.Errorf("-preserve-order and -sort-containers both set the container order and can't be combined")
+	}
+	if opts.SortBy != "" && opts.SortBy != "severity" {
+		return fmt.Errorf("unknown -sort-by %q", opts.SortBy)
+	}
+	if opts.ScaffoldWhitelist && opts.Scaffold {
+		return fmt.Errorf("-scaffold-whitelist adds placeholders to the generated configs, which -scaffold doesn't generate")
+	}
+	if opts.Explain != "" {
+		if _, err := parseExplain(opts.Explain); err != nil {
+			return err
+		}
+	}
+	if opts.GroupBy != "" && opts.GroupBy != "parent" {
+		return fmt.Errorf("unknown -group-by %q", opts.GroupBy)
+	}
+	if opts.GenPaths != "" && opts.GenPaths != "relative" && opts.GenPaths != "absolute" {
+		return fmt.Errorf("-gen-paths must be relative or absolute, not %q", opts.GenPaths)
+	}
+	if err := validFilenamePrefix(opts.FilenamePrefix); err != nil {
+		return err
+	}
+	if opts.GroupByGraph && opts.Baseline != "" {
+		return fmt.Errorf("-baseline compares flat metricThresholds lists and can't be combined with -group-by-graph")
+	}
+	if opts.GroupBy != "" && opts.Baseline != "" {
+		return fmt.Errorf("-baseline compares nested config.yaml trees and can't be combined with -group-by")
+	}
+	if opts.Severity != "" && !validSeverity(opts.Severity) {
+		return fmt.Errorf("-severity %q is not one of sev2, sev3, sev4", opts.Severity)
+	}
+	if opts.Indent < 2 {
+		return fmt.Errorf("-indent must be at least 2")
+	}
+
+	validFormats := map[string]bool{"yaml": true, "multi-yaml": true, "text": true, "csv": true, "kv": true, "prom": true}
+	if opts.DryRun {
+		validFormats["json"] = true
+	}
+	if opts.Baseline != "" || opts.Audit {
+		validFormats = map[string]bool{"yaml": true, "json": true}
+	}
+	if !validFormats[opts.Format] {
+		return fmt.Errorf("unknown format %q", opts.Format)
+	}
+	if _, err := parsePromExpr(opts.PromExpr); err != nil {
+		return fmt.Errorf("parsing -prom-expr: %v", err)
+	}
+	return nil
+}
+
+// Reads the containers from the JSON input, data when it isn't nil. When path is a directory,
+// every *.json file below it is parsed in lexical order and contributes its containers as
+// further top-level siblings, so same-named containers from different files collide just as
+// they do in one file.
+func loadContainers(path string, data []byte, opts Options) ([]Container, error) {
+	if info, err := os.Stat(path); data != nil || opts.JSONEnv != "" || err != nil || !info.IsDir() {
+		jsonFile, err := readInput(path, opts.JSONEnv, data)
+		if err != nil {
+			return nil, fmt.Errorf("reading JSON input: %v", err)
+		}
+		if data == nil && opts.JSONEnv != "" {
+			path = "$" + opts.JSONEnv
+		}
+		containers, err := parseContainers(jsonFile, opts)
+		if err != nil {
+			return nil, fmt.Errorf("parsing JSON %s: %v", path, err)
+		}
+		return containers, nil
+	}
+
+	var containers []Container
+	err := filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("reading JSON input: %v", err)
+		}
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(file), ".json") {
+			return nil
+		}
+		jsonFile, err := readUTF8File(file)
+		if err != nil {
+			return fmt.Errorf("reading JSON input: %v", err)
+		}
+		fileContainers, err := parseContainers(jsonFile, opts)
+		if err != nil {
+			return fmt.Errorf("parsing JSON %s: %v", file, err)
+		}
+		logger.Debug("read JSON input", "path", file, "containers", len(fileContainers))
+		containers = append(containers, fileContainers...)
+		return nil
+	})
+	return containers, err
+}
+
+// Decodes the containers of a JSON response, read from data.containers, from the envelope
+// keys renamed by -data-field and -containers-field, or from the dotted path of object keys
+// given by -json-path. Any other path must lead to an array of objects.
+func parseContainers(data []byte, opts Options) ([]Container, error) {
+	keys, source := opts.containersPath()
+	if len(keys) == 2 && keys[0] == "data" && keys[1] == "containers" {
+		var response Response
+		if err := json.Unmarshal(data, &response); err != nil {
+			return nil, err
+		}
+		return response.Data.Containers, nil
+	}
+
+	var node interface{}
+	if err := json.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		object, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: can't look up %q in a non-object", source, key)
+		}
+		if node, ok = object[key]; !ok {
+			return nil, fmt.Errorf("%s: no key %q", source, key)
+		}
+	}
+	items, ok := node.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s does not lead to an array", source)
+	}
+	for i, item := range items {
+		if _, ok := item.(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("%s: item %d is not an object", source, i)
+		}
+	}
+
+	// Round-trip the selected array so containers decode exactly as they do from data.containers
+	raw, err := json.Marshal(node)
+	if err != nil {
+		return nil, err
+	}
+	var containers []Container
+	if err := json.Unmarshal(raw, &containers); err != nil {
+		return nil, fmt.Errorf("%s: %v", source, err)
+	}
+	return containers, nil
+}
+
+// Returns the object keys leading to the containers array in the JSON, and how to name
+// them in errors
+func (opts Options) containersPath() ([]string, string) {
+	if opts.JSONPath != "" {
+		return strings.Split(opts.JSONPath, "."), "-json-path " + opts.JSONPath
+	}
+	dataField, containersField := opts.DataField, opts.ContainersField
+	if dataField == "" {
+		dataField = "data"
+	}
+	if containersField == "" {
+		containersField = "containers"
+	}
+	return []string{dataField, containersField}, fmt.Sprintf("envelope %s.%s", dataField, containersField)
+}
+
+// Appends the thresholds of entity.thresholdsFile, a YAML list of metric thresholds. A relative
+// path is resolved against configDir, the main YAML's directory, rather than the working directory.
+func (c *Config) loadThresholdsFile(configDir string) error {
+	path := c.Source.Entity.ThresholdsFile
+	if path == "" {
+		return nil
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(configDir, path)
+	}
+	data, err := readUTF8File(path)
+	if err != nil {
+		return err
+	}
+	var thresholds []MetricThreshold
+	if err := yaml.Unmarshal(data, &thresholds); err != nil {
+		return fmt.Errorf("parsing %s: %v", path, err)
+	}
+	c.Source.Entity.MetricThresholds = append(c.Source.Entity.MetricThresholds, thresholds...)
+	logger.Debug("loaded thresholds file", "path", path, "thresholds", len(thresholds))
+	return nil
+}
+
+// Reads an input: data when it isn't nil, else the base64-encoded contents of envVar when it
+// is set, else the file at path
+func readInput(path, envVar string, data []byte) ([]byte, error) {
+	if data != nil {
+		return utf8Input(data)
+	}
+	if envVar == "" {
+		return readUTF8File(path)
+	}
+
+	encoded, ok := os.LookupEnv(envVar)
+	if !ok {
+		return nil, fmt.Errorf("environment variable %s is not set", envVar)
+	}
+	// Tolerate line-wrapped base64 output
+	encoded = strings.Join(strings.Fields(encoded), "")
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("decoding base64 from environment variable %s: %v", envVar, err)
+	}
+	data, err = utf8Input(data)
+	if err != nil {
+		return nil, fmt.Errorf("environment variable %s: %v", envVar, err)
+	}
+	return data, nil
+}
+
+// Reads a file with utf8Input
+func readUTF8File(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err = utf8Input(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return data, nil
+}
+
+// Strips the UTF-8 byte order mark Windows tools like to prepend, and refuses UTF-16 input,
+// recognized by its byte order mark or by a NUL in its first two bytes, which would
+// otherwise parse as garbage
+func utf8Input(data []byte) ([]byte, error) {
+	if bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}) {
+		return data[3:], nil
+	}
+	if bytes.HasPrefix(data, []byte{0xFF, 0xFE}) || bytes.HasPrefix(data, []byte{0xFE, 0xFF}) ||
+		(len(data) >= 2 && (data[0] == 0 || data[1] == 0)) {
+		return nil, fmt.Errorf("input is UTF-16 encoded; convert it to UTF-8")
+	}
+	return data, nil
+}
+
+// Writes the one config in the plan, refusing plans that would produce several
+func writeSingleConfig(w io.Writer, plan []ContainerConfig, opts Options) error {
+	var selected []ContainerConfig
+	for _, planned := range plan {
+		if planned.WriteConfig {
+			selected = append(selected, planned)
+		}
+	}
+	if len(selected) != 1 {
+		return fmt.Errorf("-stdout needs exactly one container but the selection has %d; narrow it with -only", len(selected))
+	}
+
+	yamlData, err := marshalConfig(selected[0].Config, opts.configStyle())
+	if err != nil {
+		return fmt.Errorf("error marshaling YAML for %s: %v", selected[0].Container.ContainerName, err)
+	}
+	_, err = w.Write(yamlData)
+	return err
+}
+
+// Loads a newline-delimited name list, ignoring blank lines and # comments
+func loadNameList(path string) (map[string]bool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %v", path, err)
+	}
+
+	names := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		name := strings.TrimSpace(line)
+		if name == "" || strings.HasPrefix(name, "#") {
+			continue
+		}
+		names[name] = true
+	}
+	return names, nil
+}
+
+// Run performs a single generation from its JSON and YAML inputs, in whichever mode opts
+// select, giving up once ctx is done. stats receives the counts of what was written.
+func Run(ctx context.Context, gen Generation, opts Options, stats *GenerationStats) error {
+	start := time.Now()
+
+	// Read and parse JSON
+	containers, err := loadContainers(gen.JSON, gen.JSONData, opts)
+	if err != nil {
+		return err
+	}
+	if opts.Normalize {
+		normalizeContainers(containers)
+	}
+
+	// Name env-provided inputs in messages by their variable, and unnamed in-memory ones by their kind
+	switch {
+	case gen.JSONData != nil && gen.JSON == "":
+		gen.JSON = "JSON data"
+	case gen.JSONData == nil && opts.JSONEnv != "":
+		gen.JSON = "$" + opts.JSONEnv
+	}
+	// Env-provided YAML has no directory of its own, so its references resolve from the working directory
+	configDir := "."
+	switch {
+	case gen.YAMLData != nil && gen.YAML == "":
+		gen.YAML = "YAML data"
+	case gen.YAMLData == nil && opts.YAMLEnv != "":
+		gen.YAML = "$" + opts.YAMLEnv
+	default:
+		configDir = filepath.Dir(gen.YAML)
+	}
+
+	// Scaffolding starts a new YAML config, so there is none to read
+	if opts.Scaffold {
+		if err := writeReport(opts.output(), opts.OutputFile, func(w io.Writer) error {
+			return writeScaffold(w, containers, opts)
+		}); err != nil {
+			return fmt.Errorf("writing scaffold: %v", err)
+		}
+		return nil
+	}
+
+	// Read YAML file
+	yamlFile, err := readInput(gen.YAML, opts.YAMLEnv, gen.YAMLData)
+	if err != nil {
+		return fmt.Errorf("reading YAML input: %v", err)
+	}
+
+	// Parse YAML using the updated Config struct
+	var yamlConfig Config
+	if err := yaml.Unmarshal(yamlFile, &yamlConfig); err != nil {
+		return fmt.Errorf("parsing YAML %s: %v", gen.YAML, err)
+	}
+
+	if err := yamlConfig.loadThresholdsFile(configDir); err != nil {
+		return fmt.Errorf("loading thresholds referenced by %s: %v", gen.YAML, err)
+	}
+	if opts.Normalize {
+		yamlConfig.normalize()
+	}
+
+	if opts.EntityRegistry != "" {
+		registry, err := loadNameList(opts.EntityRegistry)
+		if err != nil {
+			return fmt.Errorf("loading entity registry: %v", err)
+		}
+		opts.registry = registry
+	}
+
+	if opts.ValidateOnly {
+		// Aggregate every finding rather than stopping at the first
+		problems := problemsOf(yamlConfig.Validate(opts.AllowEmptyDefaults))
+		problems = append(problems, unreachableThresholds(yamlConfig, opts)...)
+		problems = append(problems, unmatchedThresholds(containers, yamlConfig, opts)...)
+		problems = append(problems, impreciseBounds(yamlFile)...)
+		if opts.CheckParents {
+			problems = append(problems, parentMismatches(containers, "")...)
+		}
+		if opts.registry != nil {
+			problems = append(problems, unregisteredEntities(containers, yamlConfig, opts.registry)...)
+		}
+		if err := problemsError(problems); err != nil {
+			return fmt.Errorf("validating %s and %s: %v", gen.JSON, gen.YAML, err)
+		}
+		fmt.Fprintf(opts.output(), "%s and %s are valid\n", gen.JSON, gen.YAML)
+		return nil
+	}
+
+	if err := yamlConfig.Validate(opts.AllowEmptyDefaults); err != nil {
+		return fmt.Errorf("validating YAML %s: %v", gen.YAML, err)
+	}
+
+	if opts.CheckParents {
+		if err := problemsError(parentMismatches(containers, "")); err != nil {
+			return fmt.Errorf("checking parent entity IDs in %s: %v", gen.JSON, err)
+		}
+	}
+
+	if opts.ChangedFile != "" {
+		changed, err := loadNameList(opts.ChangedFile)
+		if err != nil {
+			return err
+		}
+		opts.changed = changed
+	}
+
+	plan := planStructure(containers, yamlConfig, opts)
+
+	if opts.Explain != "" {
+		// Validated with the other flags, so this can't fail
+		target, _ := parseExplain(opts.Explain)
+		if err := writeReport(opts.output(), opts.OutputFile, func(w io.Writer) error {
+			return writeExplain(w, target, yamlConfig, plan, opts)
+		}); err != nil {
+			return fmt.Errorf("writing explanation: %v", err)
+		}
+		return nil
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("timed out after planning %d containers, before writing anything", len(plan))
+	}
+
+	if opts.Strict {
+		var conflicts []string
+		for _, planned := range plan {
+			conflicts = append(conflicts, planned.conflicts()...)
+		}
+		if err := problemsError(conflicts); err != nil {
+			return fmt.Errorf("conflicting thresholds (-strict): %v", err)
+		}
+		if opts.registry != nil {
+			if err := problemsError(unregisteredEntities(containers, yamlConfig, opts.registry)); err != nil {
+				return fmt.Errorf("entities missing from %s (-strict): %v", opts.EntityRegistry, err)
+			}
+		}
+	}
+
+	warnings := collectWarnings(containers, yamlConfig, plan, opts)
+	for _, problem := range impreciseBounds(yamlFile) {
+		warnings.Add("%s %s", gen.YAML, problem)
+	}
+	warnings.Report(logger)
+	if opts.FailOnWarnings && warnings.Len() > 0 {
+		return fmt.Errorf("%d warning(s) treated as errors (-fail-on-warnings)", warnings.Len())
+	}
+
+	covered, total := thresholdCoverage(containers, yamlConfig.Source.Entity, plan, opts)
+	coverage := 1.0
+	if total > 0 {
+		coverage = float64(covered) / float64(total)
+	}
+	logger.Info("threshold coverage", "percent", fmt.Sprintf("%.1f", coverage*100), "covered", covered, "pairs", total)
+	if coverage < opts.MinCoverage {
+		return fmt.Errorf("threshold coverage %.1f%% (%d of %d entity/metric pairs) is below -min-coverage %.1f%%", coverage*100, covered, total, opts.MinCoverage*100)
+	}
+
+	if opts.Baseline != "" {
+		diffs, err := diffAgainstBaseline(opts.Baseline, opts.configFileName(), opts.DedupKey, plan)
+		if err != nil {
+			return fmt.Errorf("comparing against baseline: %v", err)
+		}
+		if err := writeReport(opts.output(), opts.OutputFile, func(w io.Writer) error {
+			return writeDiff(w, opts.Format, opts.Indent, diffs)
+		}); err != nil {
+			return fmt.Errorf("writing diff: %v", err)
+		}
+		return nil
+	}
+
+	if opts.Format == "text" {
+		if err := writeReport(opts.output(), opts.OutputFile, func(w io.Writer) error {
+			return writeTextReport(w, plan)
+		}); err != nil {
+			return fmt.Errorf("writing text report: %v", err)
+		}
+		return nil
+	}
+
+	if opts.Format == "csv" {
+		if err := writeReport(opts.output(), opts.OutputFile, func(w io.Writer) error {
+			return writeCSVReport(w, plan)
+		}); err != nil {
+			return fmt.Errorf("writing CSV report: %v", err)
+		}
+		return nil
+	}
+
+	if opts.Format == "kv" {
+		if err := writeReport(opts.output(), opts.OutputFile, func(w io.Writer) error {
+			return writeKVReport(w, plan)
+		}); err != nil {
+			return fmt.Errorf("writing key-value report: %v", err)
+		}
+		return nil
+	}
+
+	if opts.Format == "multi-yaml" {
+		if err := writeReport(opts.output(), opts.OutputFile, func(w io.Writer) error {
+			return writeMultiYAML(w, plan, opts.configStyle())
+		}); err != nil {
+			return fmt.Errorf("writing multi-document YAML: %v", err)
+		}
+		return nil
+	}
+
+	if opts.Format == "prom" {
+		if err := writeReport(opts.output(), opts.OutputFile, func(w io.Writer) error {
+			return writePromRules(w, plan, yamlConfig.Source.DefaultConfig, opts.PromExpr, opts.Indent)
+		}); err != nil {
+			return fmt.Errorf("writing Prometheus rules: %v", err)
+		}
+		return nil
+	}
+
+	if opts.Stdout {
+		return writeSingleConfig(opts.output(), plan, opts)
+	}
+
+	// Create base directory
+	basePath := gen.Out
+	if opts.Env != "" {
+		basePath = filepath.Join(basePath, sanitizeFolderName(opts.Env))
+	}
+	absPath, err := filepath.Abs(basePath)
+	if err != nil {
+		return fmt.Errorf("resolving output directory %s: %v", basePath, err)
+	}
+
+	if opts.Audit {
+		expected, err := GenerateToMap(ctx, plan, opts)
+		if err != nil {
+			return fmt.Errorf("generating expected tree: %v", err)
+		}
+		findings, err := auditTree(basePath, expected, opts.configFileName())
+		if err != nil {
+			return fmt.Errorf("auditing %s: %v", absPath, err)
+		}
+		if err := writeReport(opts.output(), opts.OutputFile, func(w io.Writer) error {
+			return writeAudit(w, opts.Format, opts.Indent, findings)
+		}); err != nil {
+			return fmt.Errorf("writing audit: %v", err)
+		}
+		if len(findings) > 0 {
+			return fmt.Errorf("audit found %d discrepancies in %s", len(findings), absPath)
+		}
+		return nil
+	}
+
+	if opts.DryRun {
+		if err := writeReport(opts.output(), opts.OutputFile, func(w io.Writer) error {
+			if opts.Format == "json" {
+				return writeDryRunJSON(w, plan)
+			}
+			return writeDryRun(w, absPath, plan, newPalette(w, opts.NoColor))
+		}); err != nil {
+			return fmt.Errorf("writing dry run: %v", err)
+		}
+		return nil
+	}
+
+	// Checked again by createStructureAndYaml, but by then the base directory exists
+	if err := checkMaxFiles(plan, opts.MaxFiles); err != nil {
+		return fmt.Errorf("creating structure: %v", err)
+	}
+	// The tree goes to the output directory and any -out mirrors alike, each with its own writer
+	bases := []string{basePath}
+	for _, mirror := range opts.Mirrors {
+		if opts.Env != "" {
+			mirror = filepath.Join(mirror, sanitizeFolderName(opts.Env))
+		}
+		for _, base := range bases {
+			if filepath.Clean(base) == filepath.Clean(mirror) {
+				return fmt.Errorf("-out %s is given more than once", mirror)
+			}
+		}
+		bases = append(bases, mirror)
+	}
+
+	// Configs identical across containers are written once and linked with -dedup-files
+	var shared map[string]bool
+	if opts.DedupFiles {
+		if shared, err = sharedContents(plan, opts.configStyle()); err != nil {
+			return fmt.Errorf("marshaling YAML: %v", err)
+		}
+	}
+
+	// Create folder structure and YAML files
+	owner := opts.Owner
+	if owner.set && !chownSupported() {
+		logger.Warn("-owner is not supported on this platform; leaving file ownership alone", "os", runtime.GOOS)
+		owner = fileOwner{}
+	}
+	destinations := make([]destination, len(bases))
+	var out multiWriter
+	for i, base := range bases {
+		abs, err := filepath.Abs(base)
+		if err != nil {
+			return fmt.Errorf("resolving output directory %s: %v", base, err)
+		}
+		logger.Info("writing output", "path", abs)
+		if err := os.MkdirAll(base, opts.DirMode.mode()); err != nil {
+			return describeFSError("creating base directory", base, err)
+		}
+		previous, err := readGeneratedManifest(base)
+		if err != nil {
+			return fmt.Errorf("reading %s manifest: %v", generatedManifest, err)
+		}
+		destinations[i] = destination{base: base, absPath: abs, previous: previous, writer: newFSWriter(base, opts.DirMode.mode(), shared, owner, opts.Retry)}
+		out = append(out, destinations[i].writer)
+	}
+	// With -archive every config also goes into each archive
+	var archives []*zipWriter
+	discardArchives := func() {
+		for _, archive := range archives {
+			archive.discard()
+		}
+	}
+	for _, path := range opts.Archives {
+		archive, err := newZipWriter(path)
+		if err != nil {
+			discardArchives()
+			return err
+		}
+		archives = append(archives, archive)
+		out = append(out, archive)
+	}
+	*stats = GenerationStats{OutputPath: absPath, Containers: int64(len(plan)), Dropped: int64(droppedThresholds(plan)), Warnings: int64(warnings.Len())}
+	if err := createStructureAndYaml(ctx, out, plan, opts, stats); err != nil {
+		discardArchives()
+		return fmt.Errorf("creating structure: %v", err)
+	}
+	for i, archive := range archives {
+		if err := archive.Close(); err != nil {
+			for _, unfinished := range archives[i+1:] {
+				unfinished.discard()
+			}
+			return err
+		}
+	}
+	for _, dest := range destinations {
+		if err := finishTree(dest, plan, opts); err != nil {
+			return err
+		}
+	}
+
+	if opts.PostHook != "" {
+		if err := runPostHook(ctx, opts.PostHook, absPath); err != nil {
+			return err
+		}
+	}
+
+	stats.Duration = time.Since(start)
+	if opts.Batched {
+		// The batch reports every generation's stats once they have all run
+		return nil
+	}
+	if opts.JSONSummary {
+		if err := writeJSONSummary(opts.output(), *stats); err != nil {
+			return fmt.Errorf("writing summary: %v", err)
+		}
+	} else if !opts.Quiet {
+		fmt.Fprintln(opts.output(), "Folder structure and YAML files created successfully!")
+	}
+	return nil
+}
+
+// destination is one output directory a generation writes its tree into
+type destination struct {
+	base, absPath string
+	// previous lists the files the last generation into base wrote, from its .generated manifest
+	previous []string
+	writer   *fsWriter
+}
+
+// Brings a destination's bookkeeping up to date once its configs are written: -clean's
+// removals, the .generated manifest, the files -gen-checksums, -gen-paths, -gen-gitignore and
+// -gen-index ask for, and -verify-paths' check of the tree
+func finishTree(dest destination, plan []ContainerConfig, opts Options) error {
+	basePath, absPath, writer := dest.base, dest.absPath, dest.writer
+	generated := writer.written
+	if opts.changed != nil || len(opts.Only) > 0 {
+		// A partial run leaves the rest of the tree, and its manifest entries, in place
+		generated = unionPaths(dest.previous, generated)
+	}
+	if opts.Clean {
+		if err := cleanOrphans(basePath, dest.previous, generated, opts.AssumeYes); err != nil {
+			return err
+		}
+	}
+	if err := writeGeneratedManifest(basePath, generated); err != nil {
+		return err
+	}
+	if opts.GenChecksums {
+		if err := writeChecksums(basePath, generated, writer.checksums); err != nil {
+			return err
+		}
+	}
+	if opts.GenPaths != "" {
+		if err := writeGeneratedPaths(basePath, absPath, generated, writer.dirs, opts.GenPaths == "absolute"); err != nil {
+			return err
+		}
+	}
+
+	if opts.VerifyPaths {
+		if err := problemsError(verifyPaths(basePath, plan)); err != nil {
+			return fmt.Errorf("verifying generated tree %s: %v", absPath, err)
+		}
+	}
+
+	if opts.GenGitignore {
+		if err := writeGitignore(basePath, opts.GitignoreTemplate, opts); err != nil {
+			return err
+		}
+	}
+
+	if opts.GenIndex {
+		if err := writeEntityIndex(basePath, plan, opts.Indent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,334 @@
+package generator_test
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pchhabra11/amexTest/generator"
+	"github.com/pchhabra11/amexTest/internal/testutil"
+)
+
+// Describes thresholds as entity/metric:min..max, for comparing against the expected
+func describe(thresholds []generator.MetricThreshold) []string {
+	described := make([]string, len(thresholds))
+	for i, threshold := range thresholds {
+		described[i] = threshold.EntityID + "/" + threshold.MetricID + ":" + bound(threshold.Min) + ".." + bound(threshold.Max)
+		if threshold.LegendName != "" {
+			described[i] += "@" + threshold.LegendName
+		}
+	}
+	return described
+}
+
+func bound(value *float64) string {
+	if value == nil {
+		return "-"
+	}
+	return strconv.FormatFloat(*value, 'f', -1, 64)
+}
+
+func checkThresholds(t *testing.T, config generator.Config, want ...string) {
+	t.Helper()
+	got := describe(config.Source.Entity.MetricThresholds)
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("thresholds = %q, want %q", got, want)
+	}
+}
+
+func TestCreateContainerYamlDedupKeepsFirst(t *testing.T) {
+	container := testutil.NewContainer("checkout").
+		WithGraph("latency").WithMeta("api", "p99").WithMeta("api", "p99").
+		WithGraph("errors").WithMeta("api", "p99").WithMeta("api", "5xx").
+		Build()
+	config := testutil.NewConfig().
+		WithThreshold("api", "p99", testutil.Unbounded, testutil.Bound(250)).
+		WithThreshold("api", "5xx", testutil.Unbounded, testutil.Bound(10)).
+		WithThreshold("api", "p99", testutil.Unbounded, testutil.Bound(250)).
+		Build()
+
+	got, conflicts, dropped := generator.CreateContainerYaml(config, container, generator.DefaultOptions())
+	checkThresholds(t, got, "api/p99:-..250", "api/5xx:-..10")
+	if len(conflicts) != 0 || dropped != 0 {
+		t.Errorf("conflicts = %q, dropped = %d, want none", conflicts, dropped)
+	}
+}
+
+func TestCreateContainerYamlDedupReportsConflict(t *testing.T) {
+	container := testutil.NewContainer("checkout").WithMeta("api", "p99").Build()
+	config := testutil.NewConfig().
+		WithThreshold("api", "p99", testutil.Unbounded, testutil.Bound(250)).
+		WithThreshold("api", "p99", testutil.Unbounded, testutil.Bound(500)).
+		WithThreshold("api", "p99", testutil.Unbounded, testutil.Bound(750)).
+		Build()
+
+	got, conflicts, _ := generator.CreateContainerYaml(config, container, generator.DefaultOptions())
+	checkThresholds(t, got, "api/p99:-..250")
+	if len(conflicts) != 1 || !strings.Contains(conflicts[0], "conflicting thresholds") {
+		t.Errorf("conflicts = %q, want one conflict for api/p99", conflicts)
+	}
+}
+
+func TestCreateContainerYamlDedupMerges(t *testing.T) {
+	container := testutil.NewContainer("checkout").WithMeta("api", "p99").Build()
+	config := testutil.NewConfig().
+		WithThreshold("api", "p99", testutil.Bound(1), testutil.Bound(500)).
+		WithThreshold("api", "p99", testutil.Bound(5), testutil.Bound(250)).
+		Build()
+	opts := generator.DefaultOptions()
+	opts.MergeThresholds = true
+
+	got, conflicts, _ := generator.CreateContainerYaml(config, container, opts)
+	checkThresholds(t, got, "api/p99:5..250")
+	if len(conflicts) != 0 {
+		t.Errorf("conflicts = %q, want none", conflicts)
+	}
+}
+
+func TestCreateContainerYamlDedupMergeReportsCrossedBounds(t *testing.T) {
+	container := testutil.NewContainer("checkout").WithMeta("api", "p99").Build()
+	config := testutil.NewConfig().
+		WithThreshold("api", "p99", testutil.Bound(300), testutil.Unbounded).
+		WithThreshold("api", "p99", testutil.Unbounded, testutil.Bound(200)).
+		Build()
+	opts := generator.DefaultOptions()
+	opts.MergeThresholds = true
+
+	_, conflicts, _ := generator.CreateContainerYaml(config, container, opts)
+	if len(conflicts) != 1 || !strings.Contains(conflicts[0], "merges to min 300 above max 200") {
+		t.Errorf("conflicts = %q, want the crossed bounds reported", conflicts)
+	}
+}
+
+func TestCreateContainerYamlDedupByLegend(t *testing.T) {
+	container := testutil.NewContainer("checkout").
+		WithLegend("api", "p99", "eu").WithLegend("api", "p99", "us").WithLegend("api", "p99", "eu").
+		Build()
+	config := testutil.NewConfig().WithThreshold("api", "p99", testutil.Unbounded, testutil.Bound(250)).Build()
+	opts := generator.DefaultOptions()
+	opts.SourceNames = true
+	if err := opts.DedupKey.Set("entity,metric,legend"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _, _ := generator.CreateContainerYaml(config, container, opts)
+	checkThresholds(t, got, "api/p99:-..250@eu", "api/p99:-..250@us")
+}
+
+func TestCreateContainerYamlDropEmptyCountsPlaceholders(t *testing.T) {
+	container := testutil.NewContainer("checkout").WithMeta("api", "p99").WithMeta("api", "5xx").Build()
+	config := testutil.NewConfig().
+		WithThreshold("api", "p99", testutil.Unbounded, testutil.Unbounded).
+		WithThreshold("api", "5xx", testutil.Unbounded, testutil.Unbounded).
+		WithThreshold("api", "5xx", testutil.Unbounded, testutil.Bound(10)).
+		Build()
+	opts := generator.DefaultOptions()
+	opts.DropEmptyThresholds = true
+
+	got, _, dropped := generator.CreateContainerYaml(config, container, opts)
+	checkThresholds(t, got, "api/5xx:-..10")
+	if dropped != 1 {
+		t.Errorf("dropped = %d, want 1", dropped)
+	}
+}
+
+func TestCreateContainerYamlMatchesEntityAndMetric(t *testing.T) {
+	container := testutil.NewContainer("checkout").WithMeta("api", "p99").WithMeta("db", "p99").Build()
+	config := testutil.NewConfig().
+		WithThreshold("api", "p99", testutil.Unbounded, testutil.Bound(250)).
+		WithThreshold("api", "p50", testutil.Unbounded, testutil.Bound(100)).
+		WithThreshold("cache", "p99", testutil.Unbounded, testutil.Bound(5)).
+		Build()
+
+	got, _, _ := generator.CreateContainerYaml(config, container, generator.DefaultOptions())
+	checkThresholds(t, got, "api/p99:-..250")
+}
+
+func TestCreateContainerYamlNoMatchIsEmptyList(t *testing.T) {
+	container := testutil.NewContainer("checkout").WithMeta("api", "p99").Build()
+	config := testutil.NewConfig().WithThreshold("db", "p99", testutil.Unbounded, testutil.Bound(5)).Build()
+
+	got, _, _ := generator.CreateContainerYaml(config, container, generator.DefaultOptions())
+	if thresholds := got.Source.Entity.MetricThresholds; thresholds == nil || len(thresholds) != 0 {
+		t.Errorf("thresholds = %#v, want an empty, non-nil list", thresholds)
+	}
+}
+
+func TestCreateContainerYamlIgnoreAndWhitelist(t *testing.T) {
+	container := testutil.NewContainer("checkout").WithMeta("api", "p99").WithMeta("db", "p99").WithMeta("cache", "p99").Build()
+	base := func() *testutil.ConfigBuilder {
+		return testutil.NewConfig().
+			WithThreshold("api", "p99", testutil.Unbounded, testutil.Bound(1)).
+			WithThreshold("db", "p99", testutil.Unbounded, testutil.Bound(2)).
+			WithThreshold("cache", "p99", testutil.Unbounded, testutil.Bound(3))
+	}
+
+	got, _, _ := generator.CreateContainerYaml(base().WithIgnored("db").Build(), container, generator.DefaultOptions())
+	checkThresholds(t, got, "api/p99:-..1", "cache/p99:-..3")
+
+	got, _, _ = generator.CreateContainerYaml(base().WithWhitelisted("db", "cache").Build(), container, generator.DefaultOptions())
+	checkThresholds(t, got, "db/p99:-..2", "cache/p99:-..3")
+
+	// An ignored entity stays out even when whitelisted
+	got, _, _ = generator.CreateContainerYaml(base().WithWhitelisted("db", "cache").WithIgnored("cache").Build(), container, generator.DefaultOptions())
+	checkThresholds(t, got, "db/p99:-..2")
+}
+
+func TestCreateContainerYamlExcludesMetrics(t *testing.T) {
+	container := testutil.NewContainer("checkout").WithMeta("api", "p99").WithMeta("api", "5xx").Build()
+	config := testutil.NewConfig().
+		WithThreshold("api", "p99", testutil.Unbounded, testutil.Bound(250)).
+		WithThreshold("api", "5xx", testutil.Unbounded, testutil.Bound(10)).
+		Build()
+	opts := generator.DefaultOptions()
+	opts.ExcludeMetrics = []string{"p99"}
+
+	got, _, _ := generator.CreateContainerYaml(config, container, opts)
+	checkThresholds(t, got, "api/5xx:-..10")
+}
+
+func TestCreateContainerYamlSeverityFilter(t *testing.T) {
+	container := testutil.NewContainer("checkout").WithMeta("api", "p99").WithMeta("api", "5xx").WithMeta("db", "p99").Build()
+	config := testutil.NewConfig().
+		With(generator.MetricThreshold{EntityID: "api", MetricID: "p99", Max: testutil.Bound(250), Incident: "sev2"}).
+		With(generator.MetricThreshold{EntityID: "api", MetricID: "5xx", Max: testutil.Bound(10), Incident: " SEV3 "}).
+		WithThreshold("db", "p99", testutil.Unbounded, testutil.Bound(5)).
+		Build()
+	config.Source.DefaultConfig.Incident.Enabled = true
+	opts := generator.DefaultOptions()
+	opts.Severity = "sev3"
+
+	// db/p99 has no incident of its own and takes the enabled default, sev3
+	got, _, _ := generator.CreateContainerYaml(config, container, opts)
+	checkThresholds(t, got, "api/5xx:-..10", "db/p99:-..5")
+}
+
+func TestCreateContainerYamlNestedContainersMatchSeparately(t *testing.T) {
+	container := testutil.NewContainer("checkout").
+		WithMeta("api", "p99").
+		WithNested(testutil.NewContainer("primary").WithMeta("db", "iops")).
+		Build()
+	config := testutil.NewConfig().
+		WithThreshold("api", "p99", testutil.Unbounded, testutil.Bound(250)).
+		WithThreshold("db", "iops", testutil.Unbounded, testutil.Bound(1000)).
+		Build()
+
+	got, _, _ := generator.CreateContainerYaml(config, container, generator.DefaultOptions())
+	checkThresholds(t, got, "api/p99:-..250")
+	nested := generator.NestedContainers(container)
+	if len(nested) != 1 {
+		t.Fatalf("nested = %+v, want primary", nested)
+	}
+	got, _, _ = generator.CreateContainerYaml(config, nested[0], generator.DefaultOptions())
+	checkThresholds(t, got, "db/iops:-..1000")
+}
+
+func TestCreateContainerYamlGraphFallback(t *testing.T) {
+	container := testutil.NewContainer("checkout").
+		WithGraph("latency").WithMeta("api", "p99").WithMeta("api", "p50").
+		WithGraph("errors").WithMeta("api", "5xx").
+		Build()
+	config := testutil.NewConfig().
+		WithGraphThreshold("latency", testutil.Unbounded, testutil.Bound(1000)).
+		WithGraphThreshold("latency", testutil.Unbounded, testutil.Bound(2000)).
+		WithThreshold("api", "p99", testutil.Unbounded, testutil.Bound(250)).
+		Build()
+
+	got, conflicts, _ := generator.CreateContainerYaml(config, container, generator.DefaultOptions())
+	// The specific threshold replaces the fallback for p99, and the first fallback wins for p50
+	checkThresholds(t, got, "api/p99:-..250", "api/p50:-..1000")
+	if len(conflicts) != 0 {
+		t.Errorf("conflicts = %q, want fallbacks never to conflict", conflicts)
+	}
+}
+
+func TestCreateContainerYamlGraphFallbackNeverMerged(t *testing.T) {
+	container := testutil.NewContainer("checkout").WithGraph("latency").WithMeta("api", "p99").Build()
+	config := testutil.NewConfig().
+		WithGraphThreshold("latency", testutil.Unbounded, testutil.Bound(100)).
+		WithThreshold("api", "p99", testutil.Unbounded, testutil.Bound(250)).
+		Build()
+	opts := generator.DefaultOptions()
+	opts.MergeThresholds = true
+
+	got, _, _ := generator.CreateContainerYaml(config, container, opts)
+	checkThresholds(t, got, "api/p99:-..250")
+}
+
+func TestCreateContainerYamlSeverityFilterKeepsFallbackOut(t *testing.T) {
+	container := testutil.NewContainer("checkout").WithGraph("latency").WithMeta("api", "p99").Build()
+	config := testutil.NewConfig().
+		With(generator.MetricThreshold{GraphName: "latency", Max: testutil.Bound(100), Incident: "sev3"}).
+		With(generator.MetricThreshold{EntityID: "api", MetricID: "p99", Max: testutil.Bound(250), Incident: "sev2"}).
+		Build()
+	opts := generator.DefaultOptions()
+	opts.Severity = "sev3"
+
+	// The sev2 threshold is filtered out, and the sev3 fallback, which the filter alone would
+	// keep, doesn't stand in for it
+	got, _, _ := generator.CreateContainerYaml(config, container, opts)
+	checkThresholds(t, got)
+}
+
+func FuzzCreateContainerYaml(f *testing.F) {
+	f.Add("api", "p99", "latency", "api", "p99", 1.0, 250.0, false)
+	f.Add("api", "p99", "latency", "", "", 0.0, 1000.0, true)
+	f.Add("", "", "", "", "", -1.0, 1.0, false)
+	f.Add("../..", "p99", "/", "../..", "p99", 5.0, 1.0, true)
+	f.Fuzz(func(t *testing.T, entity, metric, graph, thresholdEntity, thresholdMetric string, min, max float64, merge bool) {
+		container := testutil.NewContainer("fuzz").
+			WithGraph(graph).WithMeta(entity, metric).WithMeta(thresholdEntity, thresholdMetric).
+			WithGraph("other").WithMeta(entity, thresholdMetric).
+			Build()
+		config := testutil.NewConfig().
+			WithThreshold(thresholdEntity, thresholdMetric, testutil.Bound(min), testutil.Bound(max)).
+			WithThreshold(entity, metric, testutil.Unbounded, testutil.Bound(max)).
+			WithGraphThreshold(graph, testutil.Bound(min), testutil.Unbounded).
+			Build()
+		opts := generator.DefaultOptions()
+		opts.MergeThresholds = merge
+
+		got, _, _ := generator.CreateContainerYaml(config, container, opts)
+		thresholds := got.Source.Entity.MetricThresholds
+		if thresholds == nil {
+			t.Fatal("thresholds are nil, want an explicit empty list")
+		}
+		metas := map[string]bool{entity + "\x00" + metric: true, thresholdEntity + "\x00" + thresholdMetric: true, entity + "\x00" + thresholdMetric: true}
+		seen := make(map[string]bool)
+		for _, threshold := range thresholds {
+			key := threshold.EntityID + "\x00" + threshold.MetricID
+			if !metas[key] {
+				t.Errorf("threshold for %q/%q matches no graph metadata", threshold.EntityID, threshold.MetricID)
+			}
+			if seen[key] {
+				t.Errorf("threshold for %q/%q emitted twice", threshold.EntityID, threshold.MetricID)
+			}
+			seen[key] = true
+		}
+	})
+}
+
+// A container with many graphs, most of whose metadata matches a threshold
+func BenchmarkCreateContainerYaml(b *testing.B) {
+	builder := testutil.NewContainer("checkout")
+	config := testutil.NewConfig()
+	for graph := 0; graph < 50; graph++ {
+		builder.WithGraph(fmt.Sprint("graph", graph))
+		for meta := 0; meta < 40; meta++ {
+			entity, metric := fmt.Sprint("entity", meta), fmt.Sprint("metric", graph)
+			builder.WithMeta(entity, metric)
+			if meta%4 != 0 {
+				config.WithThreshold(entity, metric, testutil.Unbounded, testutil.Bound(float64(meta)))
+			}
+		}
+	}
+	container, yamlConfig := builder.Build(), config.Build()
+	opts := generator.DefaultOptions()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		generator.CreateContainerYaml(yamlConfig, container, opts)
+	}
+}
@@ -0,0 +1,62 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"text/template"
+)
+
+// Default -gitignore-template; it is executed with gitignoreData
+const defaultGitignoreTemplate = `# Generated by the monitoring structure generator; edits to these files are overwritten.
+# Mark a hand-maintained config with "# generated: false" or a .skip file instead.
+{{range .Patterns}}{{.}}
+{{end}}`
+
+// gitignoreData is what the .gitignore template can use
+type gitignoreData struct {
+	// Patterns match every file this run's options generate
+	Patterns []string
+}
+
+// Returns gitignore patterns for the files the options generate
+func generatedPatterns(opts Options) []string {
+	patterns := []string{"**/" + opts.configFileName()}
+	if opts.GroupBy == "parent" {
+		patterns = []string{"/*/" + opts.FilenamePrefix + "*.yaml"}
+	}
+	if opts.GenIndex {
+		patterns = append(patterns, "/index.yaml")
+	}
+	if opts.DedupFiles {
+		patterns = append(patterns, "/"+sharedDir+"/")
+	}
+	return patterns
+}
+
+// Writes .gitignore at the output root for -gen-gitignore, from templateFile or the default template
+func writeGitignore(basePath, templateFile string, opts Options) error {
+	text := defaultGitignoreTemplate
+	if templateFile != "" {
+		data, err := ioutil.ReadFile(templateFile)
+		if err != nil {
+			return fmt.Errorf("error reading gitignore template: %v", err)
+		}
+		text = string(data)
+	}
+	tmpl, err := template.New("gitignore").Parse(text)
+	if err != nil {
+		return fmt.Errorf("error parsing gitignore template: %v", err)
+	}
+	var content bytes.Buffer
+	if err := tmpl.Execute(&content, gitignoreData{Patterns: generatedPatterns(opts)}); err != nil {
+		return fmt.Errorf("error rendering gitignore template: %v", err)
+	}
+
+	path := filepath.Join(basePath, ".gitignore")
+	if err := ioutil.WriteFile(path, normalizeNewlines(content.Bytes()), 0644); err != nil {
+		return describeFSError("writing .gitignore", path, err)
+	}
+	return nil
+}
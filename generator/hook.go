@@ -0,0 +1,31 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Runs the -post-hook command after a successful generation. The command line is split on
+// whitespace and the absolute output base path is appended as its last argument; it is also
+// available to the command as $GENERATED_OUT. The hook's combined output is logged.
+func runPostHook(ctx context.Context, hook, outPath string) error {
+	args := strings.Fields(hook)
+	if len(args) == 0 {
+		return nil
+	}
+	cmd := exec.CommandContext(ctx, args[0], append(args[1:], outPath)...)
+	cmd.Env = append(os.Environ(), "GENERATED_OUT="+outPath)
+
+	output, err := cmd.CombinedOutput()
+	if len(output) > 0 {
+		logger.Info("post-hook output", "command", args[0], "output", strings.TrimRight(string(output), "\n"))
+	}
+	if err != nil {
+		return fmt.Errorf("error running post-hook %s: %v", args[0], err)
+	}
+	logger.Debug("ran post-hook", "command", args[0], "path", outPath)
+	return nil
+}
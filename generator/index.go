@@ -0,0 +1,43 @@
+package generator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+)
+
+// Maps each entity ID to the sorted container paths whose generated config has a threshold for it
+func buildEntityIndex(plan []ContainerConfig) map[string][]string {
+	index := make(map[string][]string)
+	for _, planned := range plan {
+		if !planned.WriteConfig {
+			continue
+		}
+		path := filepath.ToSlash(planned.Path)
+		for _, threshold := range planned.Config.Source.Entity.MetricThresholds {
+			paths := index[threshold.EntityID]
+			if len(paths) == 0 || paths[len(paths)-1] != path {
+				index[threshold.EntityID] = append(paths, path)
+			}
+		}
+	}
+	for _, paths := range index {
+		sort.Strings(paths)
+	}
+	return index
+}
+
+// Writes index.yaml at the output root for -gen-index, covering the containers in plan
+func writeEntityIndex(basePath string, plan []ContainerConfig, indent int) error {
+	data, err := encodeYAML(buildEntityIndex(plan), indent)
+	if err != nil {
+		return fmt.Errorf("error marshaling entity index: %v", err)
+	}
+	indexPath := filepath.Join(basePath, "index.yaml")
+	if err := ioutil.WriteFile(indexPath, data, 0644); err != nil {
+		return describeFSError("writing entity index", indexPath, err)
+	}
+	logger.Debug("wrote entity index", "path", indexPath)
+	return nil
+}
@@ -0,0 +1,104 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadContainersStripsBOM(t *testing.T) {
+	containers, err := loadContainers(filepath.Join("testdata", "bom.json"), nil, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 1 || containers[0].ContainerName != "checkout" {
+		t.Errorf("containers = %+v, want checkout", containers)
+	}
+}
+
+func TestLoadContainersStripsBOMInDirectory(t *testing.T) {
+	dir := t.TempDir()
+	data, err := os.ReadFile(filepath.Join("testdata", "bom.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "layout.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	containers, err := loadContainers(dir, nil, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 1 {
+		t.Errorf("containers = %+v, want checkout", containers)
+	}
+}
+
+func TestReadInputStripsBOM(t *testing.T) {
+	data, err := readInput(filepath.Join("testdata", "bom.yaml"), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("source:")) {
+		t.Errorf("read %q, want it to start at source:", data[:10])
+	}
+
+	fixture, err := os.ReadFile(filepath.Join("testdata", "bom.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("BOM_YAML", base64.StdEncoding.EncodeToString(fixture))
+	data, err = readInput("", "BOM_YAML", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("source:")) {
+		t.Errorf("read %q from the environment, want it to start at source:", data[:10])
+	}
+
+	if data, err = readInput("", "", fixture); err != nil || !bytes.HasPrefix(data, []byte("source:")) {
+		t.Errorf("readInput of in-memory data = %q, %v, want it to start at source:", data[:10], err)
+	}
+}
+
+// Both BOM-prefixed fixtures generate the same config as plain UTF-8 input would
+func TestRunWithBOMInputs(t *testing.T) {
+	defer SetLogger(logger)
+	SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	opts := DefaultOptions()
+	opts.Quiet = true
+	out := t.TempDir()
+
+	gen := Generation{JSON: filepath.Join("testdata", "bom.json"), YAML: filepath.Join("testdata", "bom.yaml"), Out: out}
+	if err := Run(context.Background(), gen, opts, &GenerationStats{}); err != nil {
+		t.Fatal(err)
+	}
+	config, err := os.ReadFile(filepath.Join(out, "checkout", "config.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(config, []byte("- entityId: api\n      metricId: p99\n      max: 250\n")) {
+		t.Errorf("config.yaml lacks the api/p99 threshold:\n%s", config)
+	}
+}
+
+func TestReadInputRejectsUTF16(t *testing.T) {
+	for _, name := range []string{"utf16le.json", "utf16be.yaml"} {
+		path := filepath.Join("testdata", name)
+		_, err := readInput(path, "", nil)
+		if err == nil || !strings.Contains(err.Error(), path+": input is UTF-16 encoded; convert it to UTF-8") {
+			t.Errorf("readInput(%s) error = %v, want it named as UTF-16", name, err)
+		}
+	}
+
+	_, err := loadContainers(filepath.Join("testdata", "utf16le.json"), nil, DefaultOptions())
+	if err == nil || !strings.Contains(err.Error(), "UTF-16") {
+		t.Errorf("loadContainers error = %v, want UTF-16 reported", err)
+	}
+}
@@ -0,0 +1,15 @@
+package generator
+
+import (
+	"log/slog"
+	"os"
+)
+
+// logger receives generation events; SetLogger replaces it
+var logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+// SetLogger sends the generator's progress, warning and debug events to l, as the command
+// line does after -log-format and -log-level
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
@@ -0,0 +1,193 @@
+package generator
+
+import (
+	"reflect"
+	"testing"
+
+	"go.yaml.in/yaml/v3"
+)
+
+func float(value float64) *float64 {
+	return &value
+}
+
+// Every type with yaml tags, fully populated, encodes under its tag names in yaml.v2's layout
+// and decodes back to the same value
+func TestEncodeYAMLTaggedTypes(t *testing.T) {
+	threshold := MetricThreshold{
+		EntityID: "api", MetricID: "p99", ParentEntityID: "svc", ContainerName: "checkout",
+		GraphName: "latency", LegendName: "eu", Min: float(1), Max: float(2.5),
+		Incident: "sev2", Description: "p99 latency", Scale: float(1000),
+		Labels: map[string]string{"team": "payments"},
+	}
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"Config", &Config{Source: Source{
+			DefaultConfig: DefaultConfig{
+				EmailConfigName: "email", SlackConfigName: "slack",
+				IncidentSevTwoConfigName: "two", IncidentSevThreeConfigName: "three", IncidentSevFourConfigName: "four",
+				Incident:    Incident{Severity: "sev3", Enabled: true},
+				SeverityMap: map[int]string{5: "five"},
+				Min:         float(0), Max: float(100),
+			},
+			Entity: Entity{
+				Name: "service", ID: "svc",
+				Ignore:           EntityIDs{EntityIds: []string{"old"}},
+				Whitelist:        EntityIDs{EntityIds: []string{"api", "db"}},
+				MetricThresholds: []MetricThreshold{threshold},
+				ThresholdsFile:   "more.yaml",
+			},
+			ContainerOverrides: map[string]NotificationOverride{"checkout": {EmailConfigName: "pay-email", SlackConfigName: "pay-slack"}},
+			Metadata:           map[string]interface{}{"tier": "gold"},
+		}}, `source:
+  defaultConfig:
+    emailConfigName: email
+    slackConfigName: slack
+    incidentSevTwoConfigName: two
+    incidentSevThreeConfigName: three
+    incidentSevFourConfigName: four
+    incident:
+      severity: sev3
+      enabled: true
+    severityMap:
+      5: five
+    min: 0
+    max: 100
+  entity:
+    name: service
+    id: svc
+    ignore:
+      entityIds:
+      - old
+    whitelist:
+      entityIds:
+      - api
+      - db
+    metricThresholds:
+    - entityId: api
+      metricId: p99
+      parentEntityId: svc
+      containerName: checkout
+      graphName: latency
+      legendName: eu
+      min: 1
+      max: 2.5
+      incident: sev2
+      description: p99 latency
+      scale: 1000
+      labels:
+        team: payments
+    thresholdsFile: more.yaml
+  containerOverrides:
+    checkout:
+      emailConfigName: pay-email
+      slackConfigName: pay-slack
+  metadata:
+    tier: gold
+`},
+		{"Generation", &Generation{JSON: "in.json", YAML: "in.yaml", Out: "out"}, `json: in.json
+yaml: in.yaml
+out: out
+`},
+		{"AuditReport", &AuditReport{Findings: []AuditFinding{{Path: "a/config.yaml", Problem: "changed", Line: 3}}}, `findings:
+- path: a/config.yaml
+  problem: changed
+  line: 3
+`},
+		{"BaselineDiff", &BaselineDiff{Containers: []ContainerDiff{{
+			Path:    "a",
+			Added:   []MetricThreshold{{EntityID: "api", MetricID: "p50"}},
+			Removed: []MetricThreshold{{EntityID: "api", MetricID: "5xx"}},
+			Changed: []ThresholdChange{{Before: MetricThreshold{EntityID: "api", MetricID: "p99", Max: float(1)}, After: MetricThreshold{EntityID: "api", MetricID: "p99", Max: float(2)}}},
+		}}}, `containers:
+- path: a
+  added:
+  - entityId: api
+    metricId: p50
+  removed:
+  - entityId: api
+    metricId: 5xx
+  changed:
+  - before:
+      entityId: api
+      metricId: p99
+      max: 1
+    after:
+      entityId: api
+      metricId: p99
+      max: 2
+`},
+		{"PromRuleFile", &PromRuleFile{Groups: []PromRuleGroup{{Name: "checkout", Rules: []PromRule{{
+			Alert: "ApiP99High", Expr: "x > 1",
+			Labels: map[string]string{"severity": "sev2"}, Annotations: map[string]string{"summary": "high"},
+		}}}}}, `groups:
+- name: checkout
+  rules:
+  - alert: ApiP99High
+    expr: x > 1
+    labels:
+      severity: sev2
+    annotations:
+      summary: high
+`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := encodeYAML(test.value, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != test.want {
+				t.Errorf("encoded as\n%s\nwant\n%s", data, test.want)
+			}
+			decoded := reflect.New(reflect.TypeOf(test.value).Elem()).Interface()
+			if err := yaml.Unmarshal(data, decoded); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(decoded, test.value) {
+				t.Errorf("decoded as %+v, want %+v", decoded, test.value)
+			}
+		})
+	}
+}
+
+// Omitted fields stay out, and empty ignore and whitelist blocks with them
+func TestEncodeYAMLOmitsEmpty(t *testing.T) {
+	data, err := encodeYAML(Config{Source: Source{Entity: Entity{Name: "service", ID: "svc", MetricThresholds: []MetricThreshold{{EntityID: "api", MetricID: "p99"}}}}}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `source:
+  defaultConfig:
+    emailConfigName: ""
+    incidentSevTwoConfigName: ""
+    incidentSevThreeConfigName: ""
+    incidentSevFourConfigName: ""
+    incident:
+      severity: ""
+      enabled: false
+  entity:
+    name: service
+    id: svc
+    metricThresholds:
+    - entityId: api
+      metricId: p99
+`
+	if string(data) != want {
+		t.Errorf("encoded as\n%s\nwant\n%s", data, want)
+	}
+}
+
+// Wider indents widen the mappings, with sequence items still under their key
+func TestEncodeYAMLIndent(t *testing.T) {
+	data, err := encodeYAML(AuditReport{Findings: []AuditFinding{{Path: "a", Problem: "extra"}}}, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "findings:\n  - path: a\n    problem: extra\n"; string(data) != want {
+		t.Errorf("encoded as %q, want %q", data, want)
+	}
+}
@@ -0,0 +1,59 @@
+package generator
+
+import "strings"
+
+// Trims surrounding whitespace from the names and IDs of containers and everything nested in
+// them, so values that differ only by padding still match
+func normalizeContainers(containers []Container) {
+	for i := range containers {
+		container := &containers[i]
+		container.ContainerName = strings.TrimSpace(container.ContainerName)
+		container.ParentEntityID = strings.TrimSpace(container.ParentEntityID)
+		for j := range container.Graphs {
+			graph := &container.Graphs[j]
+			graph.GraphName = strings.TrimSpace(graph.GraphName)
+			for k := range graph.GraphMetadata {
+				meta := &graph.GraphMetadata[k]
+				meta.LegendName = strings.TrimSpace(meta.LegendName)
+				meta.EntityID = strings.TrimSpace(meta.EntityID)
+				meta.MetricID = strings.TrimSpace(meta.MetricID)
+				meta.DeeplinkID = strings.TrimSpace(meta.DeeplinkID)
+				normalizeContainers(meta.MetadataLayout.Containers)
+			}
+		}
+	}
+}
+
+// Trims surrounding whitespace from the config's names, IDs and severities
+func (c *Config) normalize() {
+	defaults := &c.Source.DefaultConfig
+	for _, field := range []*string{
+		&defaults.EmailConfigName, &defaults.SlackConfigName,
+		&defaults.IncidentSevTwoConfigName, &defaults.IncidentSevThreeConfigName, &defaults.IncidentSevFourConfigName,
+		&defaults.Incident.Severity,
+	} {
+		*field = strings.TrimSpace(*field)
+	}
+
+	entity := &c.Source.Entity
+	entity.Name = strings.TrimSpace(entity.Name)
+	entity.ID = strings.TrimSpace(entity.ID)
+	trimAll(entity.Ignore.EntityIds)
+	trimAll(entity.Whitelist.EntityIds)
+	for i := range entity.MetricThresholds {
+		threshold := &entity.MetricThresholds[i]
+		for _, field := range []*string{
+			&threshold.EntityID, &threshold.MetricID, &threshold.ParentEntityID,
+			&threshold.ContainerName, &threshold.GraphName, &threshold.LegendName, &threshold.Incident,
+		} {
+			*field = strings.TrimSpace(*field)
+		}
+	}
+}
+
+// Trims surrounding whitespace from every value in place
+func trimAll(values []string) {
+	for i := range values {
+		values[i] = strings.TrimSpace(values[i])
+	}
+}
@@ -0,0 +1,113 @@
+package generator
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// IDs and names that differ from the YAML's only by surrounding whitespace
+const paddedJSON = `{"data": {"containers": [
+	{"container_name": "  checkout\t", "parent_entity_id": " svc ", "graphs": [{"graph_name": " latency ", "graph_metadata": [
+		{"entity_id": " api", "metric_id": "p99\n", "legend_name": " eu ", "metadata_layout": {"containers": [
+			{"container_name": " primary ", "graphs": [{"graph_name": "io", "graph_metadata": [{"entity_id": "\tdb ", "metric_id": " iops"}]}]}
+		]}}
+	]}]}
+]}}`
+
+const paddedYAML = `source:
+  defaultConfig:
+    emailConfigName: " email "
+    incidentSevTwoConfigName: sev2
+    incidentSevThreeConfigName: sev3
+    incidentSevFourConfigName: sev4
+    incident:
+      severity: " sev3 "
+  entity:
+    name: " service "
+    id: service
+    whitelist:
+      entityIds: [" api ", "db "]
+    metricThresholds:
+    - {entityId: "api ", metricId: " p99", max: 250, incident: " SEV2 "}
+    - {entityId: " db", metricId: "iops ", max: 1000}
+    - {graphName: "latency ", max: 5}
+`
+
+func paddedInputs(t *testing.T) ([]Container, Config) {
+	t.Helper()
+	containers, err := parseContainers([]byte(paddedJSON), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config Config
+	if err := yaml.Unmarshal([]byte(paddedYAML), &config); err != nil {
+		t.Fatal(err)
+	}
+	return containers, config
+}
+
+func TestNormalizeMatchesPaddedIDs(t *testing.T) {
+	containers, config := paddedInputs(t)
+	normalizeContainers(containers)
+	config.normalize()
+
+	plan := planStructure(containers, config, DefaultOptions())
+	if len(plan) != 2 {
+		t.Fatalf("planned %d containers, want 2", len(plan))
+	}
+	for i, want := range []struct{ path, entity, metric string }{
+		{"checkout", "api", "p99"},
+		{filepath.Join("checkout", "primary"), "db", "iops"},
+	} {
+		thresholds := plan[i].Config.Source.Entity.MetricThresholds
+		if plan[i].Path != want.path || len(thresholds) != 1 || thresholds[0].EntityID != want.entity || thresholds[0].MetricID != want.metric {
+			t.Errorf("planned %q with %+v, want %s with %s/%s", plan[i].Path, thresholds, want.path, want.entity, want.metric)
+		}
+	}
+	if severity := resolvedSeverity(plan[0].Config.Source.Entity.MetricThresholds[0], config.Source.DefaultConfig); severity != "sev2" {
+		t.Errorf("severity = %q, want sev2", severity)
+	}
+	if got := config.Source.DefaultConfig.EmailConfigName; got != "email" {
+		t.Errorf("emailConfigName = %q, want it trimmed", got)
+	}
+	if got := containers[0].Graphs[0].GraphMetadata[0].LegendName; got != "eu" {
+		t.Errorf("legend = %q, want it trimmed", got)
+	}
+}
+
+// Without -normalize the padded IDs match nothing, which is what the pass fixes
+func TestWithoutNormalizePaddedIDsDontMatch(t *testing.T) {
+	containers, config := paddedInputs(t)
+	for _, planned := range planStructure(containers, config, DefaultOptions()) {
+		if thresholds := planned.Config.Source.Entity.MetricThresholds; len(thresholds) != 0 {
+			t.Errorf("%q got thresholds %+v, want none", planned.Path, thresholds)
+		}
+	}
+}
+
+func TestRunNormalizesByDefault(t *testing.T) {
+	defer SetLogger(logger)
+	SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	opts := DefaultOptions()
+	opts.Quiet = true
+	out := t.TempDir()
+
+	stats := &GenerationStats{}
+	if err := Run(context.Background(), Generation{Out: out, JSONData: []byte(paddedJSON), YAMLData: []byte(paddedYAML)}, opts, stats); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{filepath.Join("checkout", "config.yaml"), filepath.Join("checkout", "primary", "config.yaml")} {
+		if _, err := os.Stat(filepath.Join(out, path)); err != nil {
+			t.Errorf("%s not written under its trimmed name: %v", path, err)
+		}
+	}
+	if stats.Thresholds != 2 {
+		t.Errorf("wrote %d thresholds, want 2", stats.Thresholds)
+	}
+}
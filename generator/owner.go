@@ -0,0 +1,81 @@
+package generator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// fileOwner is a flag.Value holding the numeric uid:gid generated files are given; the zero
+// value leaves ownership alone
+type fileOwner struct {
+	uid, gid int
+	set      bool
+}
+
+func (o *fileOwner) String() string {
+	if !o.set {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", o.uid, o.gid)
+}
+
+func (o *fileOwner) Set(value string) error {
+	uidText, gidText, ok := strings.Cut(value, ":")
+	if !ok {
+		return fmt.Errorf("owner %q must be uid:gid", value)
+	}
+	uid, err := strconv.Atoi(uidText)
+	if err != nil || uid < 0 {
+		return fmt.Errorf("invalid uid %q", uidText)
+	}
+	gid, err := strconv.Atoi(gidText)
+	if err != nil || gid < 0 {
+		return fmt.Errorf("invalid gid %q", gidText)
+	}
+	*o = fileOwner{uid: uid, gid: gid, set: true}
+	return nil
+}
+
+// Reports whether files can be chowned here; Windows has no numeric owners
+func chownSupported() bool {
+	return runtime.GOOS != "windows" && runtime.GOOS != "plan9"
+}
+
+// Gives path to the owner, if one is set
+func (o fileOwner) chown(path string) error {
+	if !o.set {
+		return nil
+	}
+	if err := os.Lchown(path, o.uid, o.gid); err != nil {
+		return fmt.Errorf("error changing owner of %s to %d:%d: %v", path, o.uid, o.gid, err)
+	}
+	return nil
+}
+
+// Gives base and each directory on the way down to base/rel to the owner, skipping those
+// already in owned
+func (o fileOwner) chownDirs(base, rel string, owned map[string]bool) error {
+	if !o.set {
+		return nil
+	}
+	dirs := []string{base}
+	for _, part := range strings.Split(filepath.Clean(rel), string(filepath.Separator)) {
+		if part != "." {
+			dirs = append(dirs, filepath.Join(dirs[len(dirs)-1], part))
+		}
+	}
+	for _, dir := range dirs {
+		if owned[dir] {
+			continue
+		}
+		if err := o.chown(dir); err != nil {
+			return err
+		}
+		owned[dir] = true
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package generator
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Name of the -gen-paths listing at the output root
+const generatedPathsFile = "generated-paths.txt"
+
+// Writes generatedPathsFile at the output root for -gen-paths: every generated file, and every
+// directory holding one or created for a container, one per line and sorted. Directories end in
+// a separator so shell tooling can tell them apart. Paths are relative to the output root, with
+// forward slashes, or with absolute, joined to absPath.
+func writeGeneratedPaths(basePath, absPath string, generated []string, dirs map[string]bool, absolute bool) error {
+	listed := make(map[string]bool)
+	for dir := range dirs {
+		listed[filepath.ToSlash(dir)+"/"] = true
+	}
+	for _, path := range generated {
+		listed[filepath.ToSlash(path)] = true
+		for dir := filepath.Dir(path); dir != "."; dir = filepath.Dir(dir) {
+			listed[filepath.ToSlash(dir)+"/"] = true
+		}
+	}
+
+	paths := make([]string, 0, len(listed))
+	for path := range listed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	if absolute {
+		for i, path := range paths {
+			full := filepath.Join(absPath, filepath.FromSlash(path))
+			if strings.HasSuffix(path, "/") {
+				full += string(filepath.Separator)
+			}
+			paths[i] = full
+		}
+	}
+
+	listPath := filepath.Join(basePath, generatedPathsFile)
+	if err := ioutil.WriteFile(listPath, []byte(strings.Join(paths, "\n")+"\n"), 0644); err != nil {
+		return describeFSError("writing generated paths", listPath, err)
+	}
+	return nil
+}
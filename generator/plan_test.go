@@ -0,0 +1,162 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+)
+
+// Containers with null or missing graphs, graphs with null metadata and metadata with a null
+// or missing layout
+const sparseJSON = `{"data": {"containers": [
+	{"container_name": "no-graphs", "graphs": null},
+	{"container_name": "missing-graphs"},
+	{"container_name": "empty-graphs", "graphs": []},
+	{"container_name": "no-metadata", "graphs": [{"graph_name": "latency", "graph_metadata": null}, {"graph_name": "errors"}]},
+	{"container_name": "no-layout", "graphs": [{"graph_name": "latency", "graph_metadata": [
+		{"entity_id": "api", "metric_id": "p99", "metadata_layout": null},
+		{"entity_id": "api", "metric_id": "p50"},
+		{"entity_id": "db", "metric_id": "p99", "metadata_layout": {"containers": null}}
+	]}]}
+]}}`
+
+func sparseContainers(t *testing.T) []Container {
+	t.Helper()
+	containers, err := parseContainers([]byte(sparseJSON), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return containers
+}
+
+func TestPlanStructureSparseContainers(t *testing.T) {
+	config := Config{Source: Source{Entity: Entity{MetricThresholds: []MetricThreshold{
+		{EntityID: "api", MetricID: "p99", Max: float(250)},
+	}}}}
+	opts := DefaultOptions()
+	opts.PreserveOrder = true
+	plan := planStructure(sparseContainers(t), config, opts)
+
+	want := map[string]int{"no-graphs": 0, "missing-graphs": 0, "empty-graphs": 0, "no-metadata": 0, "no-layout": 1}
+	if len(plan) != len(want) {
+		t.Fatalf("planned %d containers, want %d", len(plan), len(want))
+	}
+	for _, planned := range plan {
+		thresholds := planned.Config.Source.Entity.MetricThresholds
+		if !planned.WriteConfig || planned.Depth != 0 {
+			t.Errorf("%s: WriteConfig %v at depth %d, want a top-level config", planned.Path, planned.WriteConfig, planned.Depth)
+		}
+		if thresholds == nil || len(thresholds) != want[planned.Path] {
+			t.Errorf("%s: thresholds = %#v, want %d in a non-nil list", planned.Path, thresholds, want[planned.Path])
+		}
+	}
+}
+
+// Sparse containers still get an empty config when written
+func TestMarshalConfigSparseContainer(t *testing.T) {
+	config, _, _ := createContainerYaml(Config{Source: Source{Entity: Entity{Name: "service", ID: "service"}}}, Container{ContainerName: "no-graphs"}, DefaultOptions())
+	data, err := marshalConfig(config, DefaultOptions().configStyle())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "\n    metricThresholds: []\n"; !strings.Contains(string(data), want) {
+		t.Errorf("config lacks %q:\n%s", want, data)
+	}
+}
+
+// -min-graphs prunes sparse containers rather than failing on them
+func TestPlanStructureSparseContainersPruned(t *testing.T) {
+	opts := DefaultOptions()
+	opts.MinGraphs = 1
+	plan := planStructure(sparseContainers(t), Config{}, opts)
+	var paths []string
+	for _, planned := range plan {
+		paths = append(paths, planned.Path)
+	}
+	if len(paths) != 2 || paths[0] != "no-layout" || paths[1] != "no-metadata" {
+		t.Errorf("planned %q, want no-layout and no-metadata", paths)
+	}
+}
+
+func TestSparseContainerHelpers(t *testing.T) {
+	for _, container := range sparseContainers(t) {
+		if nested := nestedContainers(container); len(nested) != 0 {
+			t.Errorf("%s: nested = %+v, want none", container.ContainerName, nested)
+		}
+		if !isLeafContainer(container) {
+			t.Errorf("%s: not a leaf", container.ContainerName)
+		}
+	}
+	if count := entityCount(Container{}); count != 0 {
+		t.Errorf("entityCount of an empty container = %d, want 0", count)
+	}
+	if got := nestedThresholds(Container{Graphs: []Graph{{GraphMetadata: nil}}}, Config{}, DefaultOptions()); len(got) != 0 {
+		t.Errorf("nestedThresholds = %+v, want none", got)
+	}
+}
+
+// -sort-containers entity-count puts containers with more distinct entities first, keeping
+// input order between equal counts
+func TestSortedContainersByEntityCount(t *testing.T) {
+	containers := []Container{
+		{ContainerName: "one", Graphs: []Graph{{GraphMetadata: []GraphMeta{{EntityID: "api"}, {EntityID: "api"}}}}},
+		{ContainerName: "three", Graphs: []Graph{{GraphMetadata: []GraphMeta{{EntityID: "api"}, {EntityID: "db"}}}, {GraphMetadata: []GraphMeta{{EntityID: "cache"}}}}},
+		{ContainerName: "none"},
+		{ContainerName: "also-one", Graphs: []Graph{{GraphMetadata: []GraphMeta{{EntityID: "db"}}}}},
+	}
+	var got []string
+	for _, container := range sortedContainers(containers, "entity-count") {
+		got = append(got, container.ContainerName)
+	}
+	if want := "three one also-one none"; strings.Join(got, " ") != want {
+		t.Errorf("order = %q, want %q", got, want)
+	}
+	if containers[0].ContainerName != "one" {
+		t.Error("sorting reordered the input")
+	}
+}
+
+// -scaffold-whitelist adds a TODO placeholder for each uncovered pair of a whitelisted entity,
+// which nested containers don't inherit
+func TestPlanStructureScaffoldWhitelist(t *testing.T) {
+	child := Container{ContainerName: "child", Graphs: []Graph{{GraphName: "latency", GraphMetadata: []GraphMeta{{EntityID: "api", MetricID: "p99"}}}}}
+	parent := Container{ContainerName: "parent", Graphs: []Graph{{GraphName: "latency", GraphMetadata: []GraphMeta{
+		{EntityID: "api", MetricID: "p99", MetadataLayout: MetadataLayout{Containers: []Container{child}}},
+		{EntityID: "api", MetricID: "p50"},
+		{EntityID: "api", MetricID: "p50"},
+		{EntityID: "db", MetricID: "p99"},
+		{EntityID: "cache", MetricID: "p99"},
+	}}}}
+	config := Config{Source: Source{Entity: Entity{
+		MetricThresholds: []MetricThreshold{{EntityID: "api", MetricID: "p99", Max: float(250)}},
+		Whitelist:        EntityIDs{EntityIds: []string{"api", "cache"}},
+		Ignore:           EntityIDs{EntityIds: []string{"cache"}},
+	}}}
+	opts := DefaultOptions()
+	opts.ScaffoldWhitelist = true
+	opts.Inherit = true
+	plan := planStructure([]Container{parent}, config, opts)
+	if len(plan) != 2 {
+		t.Fatalf("planned %d containers, want 2", len(plan))
+	}
+
+	describe := func(thresholds []MetricThreshold) string {
+		var described []string
+		for _, threshold := range thresholds {
+			described = append(described, thresholdKey(threshold)+":"+formatBound(threshold.Min)+".."+formatBound(threshold.Max))
+		}
+		return strings.Join(described, " ")
+	}
+	if got, want := describe(plan[0].Config.Source.Entity.MetricThresholds), "api-p99:-..250 api-p50:-..-"; got != want {
+		t.Errorf("parent thresholds = %s, want %s", got, want)
+	}
+	if got, want := describe(plan[1].Config.Source.Entity.MetricThresholds), "api-p99:-..250"; got != want {
+		t.Errorf("child thresholds = %s, want %s", got, want)
+	}
+	data, err := marshalConfig(plan[0].Config, opts.configStyle())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "# "+whitelistPlaceholderNote+"\n") {
+		t.Errorf("config without the TODO comment:\n%s", data)
+	}
+}
@@ -0,0 +1,52 @@
+package generator
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// progress reports the share of top-level containers processed on stderr.
+// It stays silent unless stderr is a terminal.
+type progress struct {
+	total   int
+	started int
+	enabled bool
+}
+
+// Creates a progress reporter for total top-level containers
+func newProgress(total int, quiet bool) *progress {
+	return &progress{
+		total:   total,
+		enabled: !quiet && total > 0 && term.IsTerminal(int(os.Stderr.Fd())),
+	}
+}
+
+// Marks the previous top-level container as done when the next one starts
+func (p *progress) startTopLevel() {
+	if p.started > 0 {
+		p.report(p.started)
+	}
+	p.started++
+}
+
+// Marks every started top-level container as done
+func (p *progress) complete() {
+	p.report(p.started)
+}
+
+// Ends the progress line
+func (p *progress) finish() {
+	if p.enabled && p.started > 0 {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+// Rewrites the progress line with done of total top-level containers processed
+func (p *progress) report(done int) {
+	if !p.enabled {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\rGenerating: %3d%% (%d/%d top-level containers)", done*100/p.total, done, p.total)
+}
@@ -0,0 +1,150 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"text/template"
+)
+
+// defaultPromExpr selects the series for a threshold; it is executed with a promExprData
+const defaultPromExpr = `solveinsights_metric{entity_id={{quote .EntityID}},metric_id={{quote .MetricID}}}`
+
+// Functions the -prom-expr template can call. quote makes a value a PromQL string literal,
+// escaping quotes and backslashes the way PromQL's Go-style strings expect.
+var promExprFuncs = template.FuncMap{"quote": strconv.Quote}
+
+// Parses a -prom-expr template with its functions
+func parsePromExpr(text string) (*template.Template, error) {
+	return template.New("prom-expr").Funcs(promExprFuncs).Parse(text)
+}
+
+// PromRuleFile is a Prometheus alerting rules file
+type PromRuleFile struct {
+	Groups []PromRuleGroup `yaml:"groups"`
+}
+
+// PromRuleGroup holds the rules generated for the containers in one folder
+type PromRuleGroup struct {
+	Name  string     `yaml:"name"`
+	Rules []PromRule `yaml:"rules"`
+}
+
+// PromRule is a single alerting rule
+type PromRule struct {
+	Alert       string            `yaml:"alert"`
+	Expr        string            `yaml:"expr"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// promExprData is what the -prom-expr template can reference
+type promExprData struct {
+	MetricThreshold
+	// Path is the container's path in the output tree
+	Path string
+}
+
+var promInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// Builds a rules file with one rule per bounded threshold, grouped by the container's folder.
+// Containers sharing a folder, as -group-by parent puts them, share a group, since Prometheus
+// requires group names to be unique within a file. The expression fires when the selected
+// series falls below min or rises above max.
+func buildPromRules(planned []ContainerConfig, defaults DefaultConfig, exprTemplate *template.Template) (PromRuleFile, error) {
+	rules := PromRuleFile{Groups: []PromRuleGroup{}}
+	groupIndex := make(map[string]int)
+	for _, container := range planned {
+		if !container.WriteConfig {
+			continue
+		}
+		path := filepath.ToSlash(container.Path)
+		var group PromRuleGroup
+
+		for _, threshold := range container.Config.Source.Entity.MetricThresholds {
+			if threshold.Min == nil && threshold.Max == nil {
+				continue
+			}
+
+			var selector bytes.Buffer
+			if err := exprTemplate.Execute(&selector, promExprData{MetricThreshold: threshold, Path: path}); err != nil {
+				return rules, fmt.Errorf("rendering expression for %s in %s: %v", thresholdKey(threshold), path, err)
+			}
+
+			rule := PromRule{
+				Alert:  promAlertName(container.Container.ContainerName, threshold),
+				Expr:   promBoundsExpr(selector.String(), threshold),
+				Labels: make(map[string]string, len(threshold.Labels)+3),
+				Annotations: map[string]string{
+					"summary": fmt.Sprintf("%s %s outside [%s, %s]", path, threshold.LegendName, formatBound(threshold.Min), formatBound(threshold.Max)),
+				},
+			}
+			// The threshold's own labels come first so the generated identity labels win
+			for key, value := range threshold.Labels {
+				rule.Labels[key] = value
+			}
+			rule.Labels["entity_id"] = threshold.EntityID
+			rule.Labels["metric_id"] = threshold.MetricID
+			if severity := resolvedSeverity(threshold, defaults); severity != "" {
+				rule.Labels["severity"] = severity
+				if name := defaults.incidentConfigName(severity); name != "" {
+					rule.Labels["incident_config"] = name
+				}
+			}
+			group.Rules = append(group.Rules, rule)
+		}
+
+		if len(group.Rules) == 0 {
+			continue
+		}
+		if i, exists := groupIndex[path]; exists {
+			rules.Groups[i].Rules = append(rules.Groups[i].Rules, group.Rules...)
+		} else {
+			groupIndex[path] = len(rules.Groups)
+			rules.Groups = append(rules.Groups, PromRuleGroup{Name: path, Rules: group.Rules})
+		}
+	}
+	return rules, nil
+}
+
+// Combines the selector with the threshold's bounds
+func promBoundsExpr(selector string, threshold MetricThreshold) string {
+	switch {
+	case threshold.Min != nil && threshold.Max != nil:
+		return fmt.Sprintf("%s < %s or %s > %s", selector, formatBound(threshold.Min), selector, formatBound(threshold.Max))
+	case threshold.Min != nil:
+		return fmt.Sprintf("%s < %s", selector, formatBound(threshold.Min))
+	default:
+		return fmt.Sprintf("%s > %s", selector, formatBound(threshold.Max))
+	}
+}
+
+// Builds a valid Prometheus alert name from the container and legend names
+func promAlertName(containerName string, threshold MetricThreshold) string {
+	name := promInvalidChars.ReplaceAllString(containerName+"_"+threshold.LegendName, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+// Writes the Prometheus rules for the plan
+func writePromRules(w io.Writer, planned []ContainerConfig, defaults DefaultConfig, exprTemplate string, indent int) error {
+	tmpl, err := parsePromExpr(exprTemplate)
+	if err != nil {
+		return fmt.Errorf("parsing -prom-expr: %v", err)
+	}
+	rules, err := buildPromRules(planned, defaults, tmpl)
+	if err != nil {
+		return err
+	}
+	data, err := encodeYAML(rules, indent)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
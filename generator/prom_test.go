@@ -0,0 +1,47 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+)
+
+// IDs carrying quotes and backslashes stay inside their PromQL string literals
+func TestBuildPromRulesEscapesIDs(t *testing.T) {
+	plan := []ContainerConfig{{
+		Path:        "checkout",
+		WriteConfig: true,
+		Config: Config{Source: Source{Entity: Entity{MetricThresholds: []MetricThreshold{
+			{EntityID: `api"} or vector(1) #`, MetricID: `p99\`, Max: float(250)},
+		}}}},
+	}}
+	tmpl, err := parsePromExpr(defaultPromExpr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := buildPromRules(plan, DefaultConfig{}, tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules.Groups) != 1 || len(rules.Groups[0].Rules) != 1 {
+		t.Fatalf("rules = %+v, want one rule", rules)
+	}
+	want := `solveinsights_metric{entity_id="api\"} or vector(1) #",metric_id="p99\\"} > 250`
+	if got := rules.Groups[0].Rules[0].Expr; got != want {
+		t.Errorf("expr = %s, want %s", got, want)
+	}
+}
+
+// A custom -prom-expr can quote any field
+func TestParsePromExprQuote(t *testing.T) {
+	tmpl, err := parsePromExpr(`up{path={{quote .Path}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, promExprData{Path: `a"b`}); err != nil {
+		t.Fatal(err)
+	}
+	if want := `up{path="a\"b"}`; out.String() != want {
+		t.Errorf("expr = %s, want %s", out.String(), want)
+	}
+}
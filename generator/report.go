@@ -0,0 +1,173 @@
+package generator
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Writes a single-file report to outputFile, or to stdout when outputFile is empty
+func writeReport(stdout io.Writer, outputFile string, write func(w io.Writer) error) error {
+	if outputFile == "" {
+		return write(stdout)
+	}
+
+	file, err := os.Create(outputFile)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %v", outputFile, err)
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Writes one line per emitted threshold: container | entity | metric | min | max | incident
+func writeTextReport(w io.Writer, planned []ContainerConfig) error {
+	for _, container := range planned {
+		if !container.WriteConfig {
+			continue
+		}
+		for _, threshold := range container.Config.Source.Entity.MetricThresholds {
+			if _, err := fmt.Fprintf(w, "%s | %s | %s | %s | %s | %s\n",
+				filepath.ToSlash(container.Path),
+				threshold.EntityID,
+				threshold.MetricID,
+				formatBound(threshold.Min),
+				formatBound(threshold.Max),
+				orDash(threshold.Incident),
+			); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Writes every emitted threshold as a CSV row under a header, sorted by container, entity and
+// metric. Unset bounds and incidents are left empty.
+func writeCSVReport(w io.Writer, planned []ContainerConfig) error {
+	var rows [][]string
+	for _, container := range planned {
+		if !container.WriteConfig {
+			continue
+		}
+		for _, threshold := range container.Config.Source.Entity.MetricThresholds {
+			rows = append(rows, []string{
+				filepath.ToSlash(container.Path),
+				threshold.EntityID,
+				threshold.MetricID,
+				csvBound(threshold.Min),
+				csvBound(threshold.Max),
+				threshold.Incident,
+			})
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for k := 0; k < 3; k++ {
+			if rows[i][k] != rows[j][k] {
+				return rows[i][k] < rows[j][k]
+			}
+		}
+		return false
+	})
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"container", "entity", "metric", "min", "max", "incident"}); err != nil {
+		return err
+	}
+	if err := writer.WriteAll(rows); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+// Writes every emitted threshold as sorted key=value lines for a KV store, with keys like
+// container/path/config.yaml/entity/metric/min, naming the config file so containers sharing a
+// folder under -group-by parent get distinct keys. Unset bounds and incidents get no key.
+func writeKVReport(w io.Writer, planned []ContainerConfig) error {
+	var lines []string
+	for _, container := range planned {
+		if !container.WriteConfig {
+			continue
+		}
+		path := filepath.ToSlash(filepath.Join(container.Path, container.FileName))
+		for _, threshold := range container.Config.Source.Entity.MetricThresholds {
+			prefix := path + "/" + threshold.EntityID + "/" + threshold.MetricID + "/"
+			if threshold.Min != nil {
+				lines = append(lines, prefix+"min="+formatBound(threshold.Min))
+			}
+			if threshold.Max != nil {
+				lines = append(lines, prefix+"max="+formatBound(threshold.Max))
+			}
+			if threshold.Incident != "" {
+				lines = append(lines, prefix+"incident="+threshold.Incident)
+			}
+		}
+	}
+	sort.Strings(lines)
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Formats an optional threshold bound for CSV, leaving the cell empty when unset
+func csvBound(bound *float64) string {
+	if bound == nil {
+		return ""
+	}
+	return formatBound(bound)
+}
+
+// Formats an optional threshold bound, using "-" when unset
+func formatBound(bound *float64) string {
+	if bound == nil {
+		return "-"
+	}
+	return strconv.FormatFloat(*bound, 'g', -1, 64)
+}
+
+// Returns value, or "-" when it is empty
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// Writes the config of every container that gets one into a single YAML stream, one document
+// per container in plan order, each headed by a comment with the path its config.yaml would
+// have. Threshold descriptions stay as comments, as in the per-container files.
+func writeMultiYAML(w io.Writer, planned []ContainerConfig, style configStyle) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(style.indent)
+	encoder.CompactSeqIndent()
+	for _, container := range planned {
+		if !container.WriteConfig {
+			continue
+		}
+		data, err := marshalConfig(container.Config, style)
+		if err != nil {
+			return fmt.Errorf("error marshaling YAML for %s: %v", container.Container.ContainerName, err)
+		}
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("error re-reading YAML for %s: %v", container.Container.ContainerName, err)
+		}
+		doc.HeadComment = "container: " + filepath.ToSlash(filepath.Join(container.Path, container.FileName))
+		if err := encoder.Encode(&doc); err != nil {
+			return err
+		}
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,136 @@
+package generator
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Writes a starter YAML config with one threshold per distinct entity/metric pair in the
+// JSON, in first-seen order. min and max are left empty for the author to fill in, and each
+// entry is commented with the containers, graphs and legends it appears under.
+func writeScaffold(w io.Writer, containers []Container, opts Options) error {
+	thresholds, where := scaffoldThresholds(containers, opts, func(MetricThreshold) bool { return true })
+	return encodeScaffold(w, thresholds, where, opts.Indent)
+}
+
+// The TODO heading each placeholder threshold -scaffold-whitelist adds to a generated config
+const whitelistPlaceholderNote = "TODO: whitelisted but no threshold matches; set min and max"
+
+// Returns a placeholder threshold, unbounded and described with a TODO, for each entity/metric
+// pair in the container's own graph metadata whose entity is on the YAML's whitelist but which
+// none of thresholds covers, in first-seen order, for -scaffold-whitelist. Excluded metrics and
+// ignored entities get none, as they get no threshold at all.
+func whitelistPlaceholders(container Container, config Config, thresholds []MetricThreshold, opts Options) []MetricThreshold {
+	entity := config.Source.Entity
+	covered := make(map[string]bool, len(thresholds))
+	for _, threshold := range thresholds {
+		covered[thresholdKey(threshold)] = true
+	}
+	var placeholders []MetricThreshold
+	for _, graph := range container.Graphs {
+		for _, meta := range graph.GraphMetadata {
+			if !containsString(entity.Whitelist.EntityIds, meta.EntityID) || entity.filtered(meta.EntityID) || opts.metricExcluded(meta.MetricID) {
+				continue
+			}
+			placeholder := MetricThreshold{EntityID: meta.EntityID, MetricID: meta.MetricID, Description: whitelistPlaceholderNote}
+			if covered[thresholdKey(placeholder)] {
+				continue
+			}
+			covered[thresholdKey(placeholder)] = true
+			placeholders = append(placeholders, withSourceNames(placeholder, graph, meta, opts))
+		}
+	}
+	return placeholders
+}
+
+// Collects a threshold for each distinct entity/metric pair in the JSON that want accepts, in
+// first-seen order, along with the container > graph > legend locations each appears under
+func scaffoldThresholds(containers []Container, opts Options, want func(MetricThreshold) bool) ([]MetricThreshold, [][]string) {
+	var thresholds []MetricThreshold
+	seen := make(map[string]int)
+	var where [][]string
+	var collect func(containers []Container)
+	collect = func(containers []Container) {
+		for _, container := range containers {
+			for _, graph := range container.Graphs {
+				for _, meta := range graph.GraphMetadata {
+					if opts.metricExcluded(meta.MetricID) {
+						continue
+					}
+					threshold := MetricThreshold{EntityID: meta.EntityID, MetricID: meta.MetricID}
+					if !want(threshold) {
+						continue
+					}
+					location := fmt.Sprintf("%s > %s > %s", strings.TrimSpace(container.ContainerName), graph.GraphName, meta.LegendName)
+					i, exists := seen[thresholdKey(threshold)]
+					if !exists {
+						i = len(thresholds)
+						seen[thresholdKey(threshold)] = i
+						thresholds = append(thresholds, threshold)
+						where = append(where, nil)
+					}
+					if !containsString(where[i], location) {
+						where[i] = append(where[i], location)
+					}
+				}
+			}
+			collect(nestedContainers(container))
+		}
+	}
+	collect(containers)
+	return thresholds, where
+}
+
+// Encodes thresholds as a YAML config with empty min and max bounds, heading each entry with
+// its locations
+func encodeScaffold(w io.Writer, thresholds []MetricThreshold, where [][]string, indent int) error {
+	var doc yaml.Node
+	if err := doc.Encode(Config{Source: Source{Entity: Entity{MetricThresholds: thresholds}}}); err != nil {
+		return fmt.Errorf("error encoding scaffold: %v", err)
+	}
+	items := mappingValue(mappingValue(mappingValue(&doc, "source"), "entity"), "metricThresholds")
+	for i, item := range items.Content {
+		item.HeadComment = strings.Join(where[i], "\n")
+		for _, bound := range []string{"min", "max"} {
+			item.Content = append(item.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: bound},
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null"})
+		}
+	}
+
+	data, err := encodeYAML(&doc, indent)
+	if err != nil {
+		return fmt.Errorf("error encoding scaffold: %v", err)
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// Returns the value of key in a YAML mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil {
+		return nil
+	}
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// Reports whether values contains value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
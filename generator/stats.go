@@ -0,0 +1,56 @@
+package generator
+
+import (
+	"encoding/json"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// GenerationStats summarizes a completed generation for -json-summary. While the generation
+// runs, the counters are only updated through its methods, which are safe to call from
+// concurrent writers; read them once it has finished.
+type GenerationStats struct {
+	OutputPath string `json:"outputPath"`
+	// Containers counts the planned containers, ConfigFiles the configs written and Skipped
+	// the hand-maintained configs left untouched
+	Containers  int64 `json:"containers"`
+	ConfigFiles int64 `json:"configFiles"`
+	Skipped     int64 `json:"skipped"`
+	Thresholds  int64 `json:"thresholds"`
+	// Dropped counts the thresholds of written configs left out by -drop-empty-thresholds
+	Dropped  int64 `json:"dropped"`
+	Warnings int64 `json:"warnings"`
+	// Duration is the wall time of the generation, including reading the inputs
+	Duration time.Duration `json:"-"`
+}
+
+// Counts the thresholds -drop-empty-thresholds left out of the configs the plan writes
+func droppedThresholds(plan []ContainerConfig) int {
+	dropped := 0
+	for _, planned := range plan {
+		if planned.WriteConfig {
+			dropped += planned.Dropped
+		}
+	}
+	return dropped
+}
+
+// Counts a written config file and its thresholds
+func (s *GenerationStats) addConfigFile(thresholds int) {
+	atomic.AddInt64(&s.ConfigFiles, 1)
+	atomic.AddInt64(&s.Thresholds, int64(thresholds))
+}
+
+// Counts a hand-maintained config left untouched
+func (s *GenerationStats) addSkipped() {
+	atomic.AddInt64(&s.Skipped, 1)
+}
+
+// Writes the stats as a single-line JSON object, with the duration in seconds
+func writeJSONSummary(w io.Writer, stats GenerationStats) error {
+	return json.NewEncoder(w).Encode(struct {
+		GenerationStats
+		DurationSeconds float64 `json:"durationSeconds"`
+	}{stats, stats.Duration.Seconds()})
+}
@@ -0,0 +1,127 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// Containers whose configs get the given number of thresholds each
+func statsPlan(configs, thresholds int) []ContainerConfig {
+	plan := make([]ContainerConfig, configs)
+	for i := range plan {
+		metricThresholds := make([]MetricThreshold, thresholds)
+		for j := range metricThresholds {
+			metricThresholds[j] = MetricThreshold{EntityID: fmt.Sprint("entity", j), MetricID: "metric"}
+		}
+		plan[i] = ContainerConfig{
+			Path:        fmt.Sprint("container", i),
+			FileName:    "config.yaml",
+			WriteConfig: true,
+			Config:      Config{Source: Source{Entity: Entity{MetricThresholds: metricThresholds}}},
+		}
+	}
+	return plan
+}
+
+// Writers run concurrently against one GenerationStats; run with -race to check the
+// counters are updated safely
+func TestGenerationStatsConcurrentWriters(t *testing.T) {
+	const writers, configs, thresholds = 8, 50, 3
+	opts := DefaultOptions()
+	opts.Quiet = true
+	stats := &GenerationStats{}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- createStructureAndYaml(context.Background(), &mapWriter{files: make(map[string][]byte)}, statsPlan(configs, thresholds), opts, stats)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if stats.ConfigFiles != writers*configs {
+		t.Errorf("ConfigFiles = %d, want %d", stats.ConfigFiles, writers*configs)
+	}
+	if stats.Thresholds != writers*configs*thresholds {
+		t.Errorf("Thresholds = %d, want %d", stats.Thresholds, writers*configs*thresholds)
+	}
+}
+
+const statsJSON = `{"data": {"containers": [
+	{"container_name": "checkout", "graphs": [{"graph_name": "latency", "graph_metadata": [
+		{"entity_id": "api", "metric_id": "p99"},
+		{"entity_id": "db", "metric_id": "p99", "metadata_layout": {"containers": [
+			{"container_name": "primary", "graphs": [{"graph_name": "io", "graph_metadata": [{"entity_id": "db", "metric_id": "iops"}]}]}
+		]}}
+	]}]},
+	{"container_name": "search", "graphs": [{"graph_name": "latency", "graph_metadata": [{"entity_id": "api", "metric_id": "p99"}]}]}
+]}}`
+
+const statsYAML = `source:
+  defaultConfig:
+    emailConfigName: email
+    incidentSevTwoConfigName: sev2
+    incidentSevThreeConfigName: sev3
+    incidentSevFourConfigName: sev4
+    incident:
+      severity: sev3
+  entity:
+    name: service
+    id: service
+    metricThresholds:
+    - entityId: api
+      metricId: p99
+      max: 250
+    - entityId: db
+      metricId: iops
+      max: 1000
+`
+
+// Whole generations run concurrently, as -batch-parallel runs them, each counting exactly its own output
+func TestRunConcurrentGenerations(t *testing.T) {
+	defer SetLogger(logger)
+	SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	const generations = 8
+	opts := DefaultOptions()
+	opts.Quiet = true
+	opts.Batched = true
+	opts.Output = io.Discard
+	out := t.TempDir()
+
+	stats := make([]GenerationStats, generations)
+	errs := make([]error, generations)
+	var wg sync.WaitGroup
+	for i := 0; i < generations; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			gen := Generation{Out: filepath.Join(out, fmt.Sprint(i)), JSONData: []byte(statsJSON), YAMLData: []byte(statsYAML)}
+			errs[i] = Run(context.Background(), gen, opts, &stats[i])
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < generations; i++ {
+		if errs[i] != nil {
+			t.Fatalf("generation %d: %v", i, errs[i])
+		}
+		if got := stats[i]; got.Containers != 3 || got.ConfigFiles != 3 || got.Thresholds != 3 || got.Skipped != 0 {
+			t.Errorf("generation %d: stats = %+v, want 3 containers and config files with 3 thresholds", i, got)
+		}
+	}
+}
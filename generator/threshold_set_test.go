@@ -0,0 +1,102 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestThresholdSetDedupKey(t *testing.T) {
+	set := newThresholdSet(dedupKey{"entity", "metric"}, 0)
+	first := MetricThreshold{EntityID: "ab", MetricID: "c"}
+	if i := set.add(first); i != 0 {
+		t.Fatalf("add = %d, want 0", i)
+	}
+	// The field separator keeps shifted boundaries apart
+	if i := set.index(MetricThreshold{EntityID: "a", MetricID: "bc"}); i != -1 {
+		t.Errorf("index of a/bc = %d, want -1", i)
+	}
+	if i := set.index(MetricThreshold{EntityID: "ab", MetricID: "c", LegendName: "eu"}); i != 0 {
+		t.Errorf("index of ab/c with a legend = %d, want 0 since the key ignores legends", i)
+	}
+}
+
+// Thresholds whose hashes collide are told apart by their fields. 64-bit collisions are
+// impractical to find, so b's hash is pointed at a's slot as if it had collided.
+func TestThresholdSetCollisions(t *testing.T) {
+	set := newThresholdSet(dedupKey{"entity"}, 0)
+	a := MetricThreshold{EntityID: "a"}
+	b := MetricThreshold{EntityID: "b"}
+	set.add(a)
+	set.thresholds = append(set.thresholds, b)
+	set.byHash[set.key.hash(b)] = 0
+	set.collisions = map[uint64][]int{set.key.hash(b): {1}}
+
+	if i := set.index(a); i != 0 {
+		t.Errorf("index of a = %d, want 0", i)
+	}
+	if i := set.index(b); i != 1 {
+		t.Errorf("index of b = %d, want 1, from the colliding thresholds", i)
+	}
+	if i := set.index(MetricThreshold{EntityID: "c"}); i != -1 {
+		t.Errorf("index of c = %d, want -1", i)
+	}
+}
+
+// Thresholds with IDs as long as the largest inputs', unique by entity
+func longThresholds(n int) []MetricThreshold {
+	thresholds := make([]MetricThreshold, n)
+	prefix := strings.Repeat("x", 200)
+	for i := range thresholds {
+		thresholds[i] = MetricThreshold{EntityID: fmt.Sprintf("%s-entity-%d", prefix, i), MetricID: prefix + "-metric"}
+	}
+	return thresholds
+}
+
+// The hashed set against the joined key strings it replaced, deduplicating each threshold
+// seen twice
+func BenchmarkDedup(b *testing.B) {
+	thresholds := longThresholds(10000)
+	b.Run("hash", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			set := newThresholdSet(dedupKey{"entity", "metric"}, len(thresholds))
+			for _, threshold := range append(thresholds, thresholds...) {
+				if set.index(threshold) < 0 {
+					set.add(threshold)
+				}
+			}
+		}
+	})
+	b.Run("string", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			seen := make(map[string]int, len(thresholds))
+			unique := make([]MetricThreshold, 0, len(thresholds))
+			for _, threshold := range append(thresholds, thresholds...) {
+				key := thresholdKey(threshold)
+				if _, exists := seen[key]; !exists {
+					seen[key] = len(unique)
+					unique = append(unique, threshold)
+				}
+			}
+		}
+	})
+}
+
+// Sets sized for their thresholds up front, as createContainerYaml sizes them, against sets
+// left to grow
+func BenchmarkThresholdSetSizing(b *testing.B) {
+	thresholds := longThresholds(1000)
+	for _, capacity := range []int{0, len(thresholds)} {
+		b.Run(fmt.Sprint("capacity=", capacity), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				set := newThresholdSet(dedupKey{"entity", "metric"}, capacity)
+				for _, threshold := range thresholds {
+					set.add(threshold)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !plan9
+
+package generator
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Reports whether err is worth retrying: an I/O error, an interrupted or timed-out call, a busy
+// resource or a stale network file handle
+func transientFSError(err error) bool {
+	for _, errno := range []syscall.Errno{syscall.EIO, syscall.EINTR, syscall.EAGAIN, syscall.EBUSY, syscall.ETIMEDOUT, syscall.ESTALE} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
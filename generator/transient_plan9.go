@@ -0,0 +1,7 @@
+package generator
+
+// Plan 9 reports errors as strings rather than errno values, so nothing is recognized as
+// transient there and -retry has no effect
+func transientFSError(err error) bool {
+	return false
+}
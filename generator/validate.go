@@ -0,0 +1,428 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// ValidationError lists every problem found while validating the inputs
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%d validation problem(s):\n  - %s", len(e.Problems), strings.Join(e.Problems, "\n  - "))
+}
+
+// Validate checks the YAML configuration and returns a *ValidationError naming every problem found.
+// allowEmptyDefaults skips the required DefaultConfig field checks.
+func (c Config) Validate(allowEmptyDefaults bool) error {
+	var problems []string
+
+	if !allowEmptyDefaults {
+		problems = append(problems, c.Source.DefaultConfig.missingFields()...)
+	}
+
+	if strings.TrimSpace(c.Source.Entity.Name) == "" {
+		problems = append(problems, "source.entity.name is required")
+	}
+	if strings.TrimSpace(c.Source.Entity.ID) == "" {
+		problems = append(problems, "source.entity.id is required")
+	}
+
+	var levels []int
+	for level := range c.Source.DefaultConfig.SeverityMap {
+		levels = append(levels, level)
+	}
+	sort.Ints(levels)
+	for _, level := range levels {
+		name := c.Source.DefaultConfig.SeverityMap[level]
+		if level < minSeverityLevel || level > maxSeverityLevel {
+			problems = append(problems, fmt.Sprintf("source.defaultConfig.severityMap: severity %d is not between %d and %d", level, minSeverityLevel, maxSeverityLevel))
+		} else if strings.TrimSpace(name) == "" {
+			problems = append(problems, fmt.Sprintf("source.defaultConfig.severityMap: severity %d has no config name", level))
+		}
+	}
+
+	if !c.Source.DefaultConfig.knownSeverity(c.Source.DefaultConfig.Incident.Severity) {
+		problems = append(problems, fmt.Sprintf("source.defaultConfig.incident.severity %q is not one of sev2, sev3, sev4", c.Source.DefaultConfig.Incident.Severity))
+	}
+
+	for _, bound := range nonFiniteBounds(c.Source.DefaultConfig.Min, c.Source.DefaultConfig.Max) {
+		problems = append(problems, fmt.Sprintf("source.defaultConfig: %s must be a finite number", bound))
+	}
+	if defaults := c.Source.DefaultConfig; defaults.Min != nil && defaults.Max != nil && *defaults.Min > *defaults.Max {
+		problems = append(problems, fmt.Sprintf("source.defaultConfig: min %v is greater than max %v", *defaults.Min, *defaults.Max))
+	}
+
+	for i, threshold := range c.Source.Entity.MetricThresholds {
+		if !c.Source.DefaultConfig.knownSeverity(threshold.Incident) {
+			problems = append(problems, fmt.Sprintf("%s: incident %q is not one of sev2, sev3, sev4", thresholdLocation(i, threshold), threshold.Incident))
+		}
+		nonFinite := nonFiniteBounds(threshold.Min, threshold.Max)
+		for _, bound := range nonFinite {
+			problems = append(problems, fmt.Sprintf("%s: %s must be a finite number", thresholdLocation(i, threshold), bound))
+		}
+		switch scale := threshold.Scale; {
+		case scale == nil:
+		case !(*scale > 0):
+			problems = append(problems, fmt.Sprintf("%s: scale %v must be positive", thresholdLocation(i, threshold), *scale))
+		case math.IsInf(*scale, 1):
+			problems = append(problems, fmt.Sprintf("%s: scale %v must be a finite number", thresholdLocation(i, threshold), *scale))
+		case len(nonFinite) == 0:
+			// Finite bounds can still overflow once multiplied
+			for _, bound := range nonFiniteBounds(scaledBound(threshold.Min, *scale), scaledBound(threshold.Max, *scale)) {
+				problems = append(problems, fmt.Sprintf("%s: scale %v takes the bounds to %s", thresholdLocation(i, threshold), *scale, bound))
+			}
+		}
+		for key := range threshold.Labels {
+			if strings.TrimSpace(key) == "" {
+				problems = append(problems, fmt.Sprintf("%s: label keys must not be empty", thresholdLocation(i, threshold)))
+				break
+			}
+		}
+		// Compare the bounds as generated, after defaultConfig fills the unset ones
+		threshold = resolvedBounds(threshold, c.Source.DefaultConfig)
+		if threshold.Min != nil && threshold.Max != nil && *threshold.Min > *threshold.Max {
+			problems = append(problems, fmt.Sprintf("%s: min %v is greater than max %v", thresholdLocation(i, threshold), *threshold.Min, *threshold.Max))
+		}
+	}
+
+	return problemsError(problems)
+}
+
+// Describes each of min and max that is set but infinite or NaN, like YAML's .inf and .nan
+func nonFiniteBounds(min, max *float64) []string {
+	var bounds []string
+	if min != nil && (math.IsInf(*min, 0) || math.IsNaN(*min)) {
+		bounds = append(bounds, fmt.Sprintf("min %v", *min))
+	}
+	if max != nil && (math.IsInf(*max, 0) || math.IsNaN(*max)) {
+		bounds = append(bounds, fmt.Sprintf("max %v", *max))
+	}
+	return bounds
+}
+
+// Wraps problems in a *ValidationError, or returns nil when there are none
+func problemsError(problems []string) error {
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// Returns the problems listed in a validation error, or the error itself as a single problem
+func problemsOf(err error) []string {
+	if err == nil {
+		return nil
+	}
+	if validationErr, ok := err.(*ValidationError); ok {
+		return validationErr.Problems
+	}
+	return []string{err.Error()}
+}
+
+// Normalizes an incident severity for comparison; empty means no severity
+func normalizeSeverity(severity string) string {
+	return strings.ToLower(strings.TrimSpace(severity))
+}
+
+// Range of numeric severities a severityMap can name configs for
+const (
+	minSeverityLevel = 1
+	maxSeverityLevel = 5
+)
+
+// Parses a sevN severity into N, for N in the severityMap range
+func severityLevel(severity string) (int, bool) {
+	normalized := normalizeSeverity(severity)
+	if !strings.HasPrefix(normalized, "sev") {
+		return 0, false
+	}
+	level, err := strconv.Atoi(strings.TrimPrefix(normalized, "sev"))
+	if err != nil || level < minSeverityLevel || level > maxSeverityLevel {
+		return 0, false
+	}
+	return level, true
+}
+
+// Reports whether severity is valid for this config: empty, one of the legacy sev2-4 or
+// mapped by severityMap
+func (d DefaultConfig) knownSeverity(severity string) bool {
+	if validSeverity(severity) {
+		return true
+	}
+	level, ok := severityLevel(severity)
+	return ok && d.SeverityMap[level] != ""
+}
+
+// Returns the incident config name for a severity: its severityMap entry, else the legacy
+// sev2-4 field, else ""
+func (d DefaultConfig) incidentConfigName(severity string) string {
+	level, ok := severityLevel(severity)
+	if !ok {
+		return ""
+	}
+	if name := strings.TrimSpace(d.SeverityMap[level]); name != "" {
+		return name
+	}
+	switch level {
+	case 2:
+		return d.IncidentSevTwoConfigName
+	case 3:
+		return d.IncidentSevThreeConfigName
+	case 4:
+		return d.IncidentSevFourConfigName
+	}
+	return ""
+}
+
+// Reports whether severity is empty or one of the supported incident severities
+func validSeverity(severity string) bool {
+	switch normalizeSeverity(severity) {
+	case "", "sev2", "sev3", "sev4":
+		return true
+	}
+	return false
+}
+
+// Describes where a threshold sits in the YAML for problem reports
+func thresholdLocation(index int, threshold MetricThreshold) string {
+	return fmt.Sprintf("source.entity.metricThresholds[%d] (entityId %q, metricId %q)", index, threshold.EntityID, threshold.MetricID)
+}
+
+// Returns a problem for every threshold that matches no graph metadata anywhere in the JSON
+func unmatchedThresholds(containers []Container, config Config, opts Options) []string {
+	metricKeys := make(map[string]bool)
+	graphNames := make(map[string]bool)
+	collectMetricKeys(containers, config.Source.Entity, opts, metricKeys, graphNames)
+
+	var problems []string
+	for i, threshold := range config.Source.Entity.MetricThresholds {
+		if opts.metricExcluded(threshold.MetricID) || threshold.EntityID != "" && config.Source.Entity.filtered(threshold.EntityID) {
+			// Reported by unreachableThresholds instead
+			continue
+		}
+		if isGraphLevel(threshold) {
+			if !graphNames[threshold.GraphName] {
+				problems = append(problems, fmt.Sprintf("%s matches no graph named %q in the JSON", thresholdLocation(i, threshold), threshold.GraphName))
+			}
+		} else if !metricKeys[thresholdKey(threshold)] {
+			problems = append(problems, fmt.Sprintf("%s matches no graph metadata in the JSON", thresholdLocation(i, threshold)))
+		}
+	}
+	return problems
+}
+
+// Returns a problem for every threshold the filters make permanently unreachable: its
+// entity is ignored or missing from a non-empty whitelist, or its metric is excluded.
+// This doesn't depend on the JSON, unlike unmatchedThresholds.
+func unreachableThresholds(config Config, opts Options) []string {
+	entity := config.Source.Entity
+	var problems []string
+	for i, threshold := range config.Source.Entity.MetricThresholds {
+		switch {
+		case opts.metricExcluded(threshold.MetricID):
+			problems = append(problems, fmt.Sprintf("%s can never match: metric is excluded by -exclude-metric", thresholdLocation(i, threshold)))
+		case threshold.EntityID == "":
+			// Graph-level thresholds apply to whatever entities their graph holds
+		case containsString(entity.Ignore.EntityIds, threshold.EntityID):
+			problems = append(problems, fmt.Sprintf("%s can never match: entity is in source.entity.ignore", thresholdLocation(i, threshold)))
+		case entity.filtered(threshold.EntityID):
+			problems = append(problems, fmt.Sprintf("%s can never match: entity is not in source.entity.whitelist", thresholdLocation(i, threshold)))
+		}
+	}
+	return problems
+}
+
+// Records the entityId/metricId key of every graph metadata entry in the container tree that
+// can get a threshold, and the names of graphs with at least one such entry
+func collectMetricKeys(containers []Container, entity Entity, opts Options, metricKeys, graphNames map[string]bool) {
+	for _, container := range containers {
+		for _, graph := range container.Graphs {
+			for _, meta := range graph.GraphMetadata {
+				if !opts.metricExcluded(meta.MetricID) && !entity.filtered(meta.EntityID) {
+					metricKeys[thresholdKey(MetricThreshold{EntityID: meta.EntityID, MetricID: meta.MetricID})] = true
+					graphNames[graph.GraphName] = true
+				}
+			}
+		}
+		collectMetricKeys(nestedContainers(container), entity, opts, metricKeys, graphNames)
+	}
+}
+
+// Counts the distinct entity/metric pairs in the JSON and how many of them got a threshold in
+// the plan. Pairs of excluded metrics and of entities the ignore and whitelist blocks filter
+// out count toward neither.
+func thresholdCoverage(containers []Container, entity Entity, plan []ContainerConfig, opts Options) (covered, total int) {
+	metricKeys := make(map[string]bool)
+	collectMetricKeys(containers, entity, opts, metricKeys, make(map[string]bool))
+	matched := make(map[string]bool)
+	for _, planned := range plan {
+		if !planned.WriteConfig {
+			continue
+		}
+		for _, threshold := range planned.Config.Source.Entity.MetricThresholds {
+			key := thresholdKey(threshold)
+			if metricKeys[key] && !matched[key] {
+				matched[key] = true
+				covered++
+			}
+		}
+	}
+	return covered, len(metricKeys)
+}
+
+// Returns a problem for each notification routing field left empty
+func (d DefaultConfig) missingFields() []string {
+	required := []struct {
+		name  string
+		value string
+		// level is the severity a severityMap entry can name the config for instead
+		level int
+	}{
+		{"emailConfigName", d.EmailConfigName, 0},
+		{"incidentSevTwoConfigName", d.IncidentSevTwoConfigName, 2},
+		{"incidentSevThreeConfigName", d.IncidentSevThreeConfigName, 3},
+		{"incidentSevFourConfigName", d.IncidentSevFourConfigName, 4},
+	}
+
+	var problems []string
+	for _, field := range required {
+		if field.level > 0 && strings.TrimSpace(d.SeverityMap[field.level]) != "" {
+			continue
+		}
+		if strings.TrimSpace(field.value) == "" {
+			problems = append(problems, fmt.Sprintf("source.defaultConfig.%s is required", field.name))
+		}
+	}
+	return problems
+}
+
+// Returns a problem for every nested container whose ParentEntityID doesn't match the
+// deeplink ID (or, without one, the entity ID) of the graph metadata enclosing it
+func parentMismatches(containers []Container, parentPath string) []string {
+	var problems []string
+	for _, container := range containers {
+		path := container.ContainerName
+		if parentPath != "" {
+			path = parentPath + "/" + path
+		}
+
+		for _, graph := range container.Graphs {
+			for _, meta := range graph.GraphMetadata {
+				expected := meta.DeeplinkID
+				if expected == "" {
+					expected = meta.EntityID
+				}
+				for _, nested := range meta.MetadataLayout.Containers {
+					if nested.ParentEntityID != expected {
+						problems = append(problems, fmt.Sprintf("container %s/%s has parent_entity_id %q but is nested under %s (graph %q, legend %q)",
+							path, nested.ContainerName, nested.ParentEntityID, expected, graph.GraphName, meta.LegendName))
+					}
+				}
+			}
+		}
+
+		problems = append(problems, parentMismatches(nestedContainers(container), path)...)
+	}
+	return problems
+}
+
+// Returns a problem for every threshold and container that references an entity missing from
+// the registry: a threshold's entityId or parentEntityId, a container's parent_entity_id or its
+// graph metadata's entity_id
+func unregisteredEntities(containers []Container, config Config, registry map[string]bool) []string {
+	var problems []string
+	for i, threshold := range config.Source.Entity.MetricThresholds {
+		if threshold.EntityID != "" && !registry[threshold.EntityID] {
+			problems = append(problems, fmt.Sprintf("%s references entity %q, which is not in the registry", thresholdLocation(i, threshold), threshold.EntityID))
+		}
+		if threshold.ParentEntityID != "" && !registry[threshold.ParentEntityID] {
+			problems = append(problems, fmt.Sprintf("%s references parent entity %q, which is not in the registry", thresholdLocation(i, threshold), threshold.ParentEntityID))
+		}
+	}
+	return append(problems, unregisteredContainerEntities(containers, "", registry)...)
+}
+
+func unregisteredContainerEntities(containers []Container, parentPath string, registry map[string]bool) []string {
+	var problems []string
+	for _, container := range containers {
+		path := container.ContainerName
+		if parentPath != "" {
+			path = parentPath + "/" + path
+		}
+		if container.ParentEntityID != "" && !registry[container.ParentEntityID] {
+			problems = append(problems, fmt.Sprintf("container %s has parent_entity_id %q, which is not in the registry", path, container.ParentEntityID))
+		}
+		for _, graph := range container.Graphs {
+			for _, meta := range graph.GraphMetadata {
+				if meta.EntityID != "" && !registry[meta.EntityID] {
+					problems = append(problems, fmt.Sprintf("container %s (graph %q, legend %q) has entity_id %q, which is not in the registry",
+						path, graph.GraphName, meta.LegendName, meta.EntityID))
+				}
+			}
+		}
+		problems = append(problems, unregisteredContainerEntities(nestedContainers(container), path, registry)...)
+	}
+	return problems
+}
+
+// Finds threshold min/max literals in the raw YAML that a float64 can't hold exactly enough to
+// print back, like integers above 2^53, described with their line and the value actually used
+func impreciseBounds(data []byte) []string {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil
+	}
+	var problems []string
+	var walk func(node *yaml.Node, inThresholds bool)
+	walk = func(node *yaml.Node, inThresholds bool) {
+		if node.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key, value := node.Content[i], node.Content[i+1]
+				if inThresholds && (key.Value == "min" || key.Value == "max") && value.Kind == yaml.ScalarNode {
+					if used, lossy := lossyFloat(value.Value); lossy {
+						problems = append(problems, fmt.Sprintf("line %d: %s %s can't be represented exactly and is read as %s", value.Line, key.Value, value.Value, used))
+					}
+				}
+				walk(value, inThresholds || key.Value == "metricThresholds")
+			}
+			return
+		}
+		for _, child := range node.Content {
+			walk(child, inThresholds)
+		}
+	}
+	walk(&root, false)
+	return problems
+}
+
+// Reports whether a numeric literal changes value when parsed as a float64, along with the
+// shortest form of the float64 it becomes. Literals too large for a float64, like 1e400, are
+// lossy, becoming infinite; those that aren't plain numbers are never lossy.
+func lossyFloat(literal string) (string, bool) {
+	parsed, err := strconv.ParseFloat(literal, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		return strconv.FormatFloat(parsed, 'g', -1, 64), true
+	}
+	if err != nil {
+		return "", false
+	}
+	exact, ok := new(big.Float).SetPrec(512).SetString(literal)
+	if !ok {
+		return "", false
+	}
+	used := strconv.FormatFloat(parsed, 'g', -1, 64)
+	// Shortest round-trip form equal to the literal means nothing was lost that the
+	// literal itself expressed; 0.1 stays 0.1 even though it isn't binary-exact
+	shortest, _ := new(big.Float).SetPrec(512).SetString(used)
+	return used, exact.Cmp(shortest) != 0
+}
@@ -0,0 +1,124 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// A valid config with extra defaultConfig fields and the given metricThresholds items, each
+// already indented to its level
+func configYAML(defaults, thresholds string) string {
+	return `source:
+  defaultConfig:
+    emailConfigName: email
+    incidentSevTwoConfigName: sev2
+    incidentSevThreeConfigName: sev3
+    incidentSevFourConfigName: sev4
+    incident:
+      severity: sev3
+` + defaults + `  entity:
+    name: service
+    id: service
+    metricThresholds:
+` + thresholds
+}
+
+// Parses a YAML config and returns the problems Validate finds in it
+func validationProblems(t *testing.T, data string) []string {
+	t.Helper()
+	var config Config
+	if err := yaml.Unmarshal([]byte(data), &config); err != nil {
+		t.Fatal(err)
+	}
+	return problemsOf(config.Validate(false))
+}
+
+func TestValidateRejectsNonFiniteBounds(t *testing.T) {
+	for _, test := range []struct {
+		bounds string
+		want   []string
+	}{
+		{"min: .inf", []string{"min +Inf must be a finite number"}},
+		{"max: -.inf", []string{"max -Inf must be a finite number"}},
+		{"max: .Inf", []string{"max +Inf must be a finite number"}},
+		{"min: .nan", []string{"min NaN must be a finite number"}},
+		{"max: .NaN", []string{"max NaN must be a finite number"}},
+		{"min: .nan, max: .inf", []string{"min NaN must be a finite number", "max +Inf must be a finite number"}},
+	} {
+		t.Run(test.bounds, func(t *testing.T) {
+			threshold := "    - {entityId: api, metricId: p99, " + test.bounds + "}\n"
+			problems := validationProblems(t, configYAML("", threshold))
+			if len(problems) != len(test.want) {
+				t.Fatalf("problems = %q, want %d", problems, len(test.want))
+			}
+			for i, want := range test.want {
+				if want = `source.entity.metricThresholds[0] (entityId "api", metricId "p99"): ` + want; problems[i] != want {
+					t.Errorf("problem = %q, want %q", problems[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateRejectsNonFiniteDefaults(t *testing.T) {
+	problems := validationProblems(t, configYAML("    min: -.inf\n    max: .nan\n", "    - {entityId: api, metricId: p99}\n"))
+	want := []string{"source.defaultConfig: min -Inf must be a finite number", "source.defaultConfig: max NaN must be a finite number"}
+	if strings.Join(problems, "\n") != strings.Join(want, "\n") {
+		t.Errorf("problems = %q, want %q", problems, want)
+	}
+}
+
+func TestValidateAcceptsFiniteBounds(t *testing.T) {
+	if problems := validationProblems(t, configYAML("    max: 1e300\n", "    - {entityId: api, metricId: p99, min: -1.5e308, max: 0}\n")); len(problems) != 0 {
+		t.Errorf("problems = %q, want none", problems)
+	}
+}
+
+func TestLossyFloat(t *testing.T) {
+	for _, test := range []struct {
+		literal string
+		used    string
+		lossy   bool
+	}{
+		{"9007199254740992", "9.007199254740992e+15", false}, // 2^53, the last integer every smaller one fits below
+		{"9007199254740993", "9.007199254740992e+15", true},
+		{"9007199254740994", "9.007199254740994e+15", false},
+		{"18014398509481985", "1.8014398509481984e+16", true},
+		{"0.1", "0.1", false},
+		{"1e308", "1e+308", false},
+		{"1.7976931348623157e308", "1.7976931348623157e+308", false}, // the largest float64
+		{"1e400", "+Inf", true},
+		{"-1e400", "-Inf", true},
+		{"1e-400", "0", true},
+		{"0.30000000000000000001", "0.3", true},
+		{"250", "250", false},
+		{"-12.5", "-12.5", false},
+		{".inf", "+Inf", false},
+		{"ten", "", false},
+	} {
+		used, lossy := lossyFloat(test.literal)
+		if lossy != test.lossy || lossy && used != test.used {
+			t.Errorf("lossyFloat(%q) = %q, %v, want %q, %v", test.literal, used, lossy, test.used, test.lossy)
+		}
+	}
+}
+
+// Only the thresholds' own bounds are checked, so the defaultConfig max passes
+func TestImpreciseBounds(t *testing.T) {
+	data := configYAML("    max: 9007199254740993\n", `    - entityId: api
+      metricId: bytes
+      min: 9007199254740992
+      max: 9007199254740993
+    - {entityId: api, metricId: huge, max: 1e400}
+`)
+	problems := impreciseBounds([]byte(data))
+	want := []string{
+		"line 17: max 9007199254740993 can't be represented exactly and is read as 9.007199254740992e+15",
+		"line 18: max 1e400 can't be represented exactly and is read as +Inf",
+	}
+	if strings.Join(problems, "\n") != strings.Join(want, "\n") {
+		t.Errorf("problems = %q, want %q", problems, want)
+	}
+}
@@ -0,0 +1,32 @@
+package generator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Re-walks the planned tree under basePath and describes every directory or config file that
+// generation intended to create but is missing, or every config file that is empty
+func verifyPaths(basePath string, plan []ContainerConfig) []string {
+	var problems []string
+	for _, planned := range plan {
+		dir := filepath.Join(basePath, planned.Path)
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("directory %s is missing", dir))
+			continue
+		}
+		if !planned.WriteConfig {
+			continue
+		}
+		file := filepath.Join(dir, planned.FileName)
+		info, err := os.Stat(file)
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("config %s is missing", file))
+		case info.Size() == 0:
+			problems = append(problems, fmt.Sprintf("config %s is empty", file))
+		}
+	}
+	return problems
+}
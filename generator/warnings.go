@@ -0,0 +1,94 @@
+package generator
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+)
+
+// Warnings collects the non-fatal problems found during a run in one place, so they
+// are reported together and -fail-on-warnings can promote all of them at once
+type Warnings struct {
+	messages []string
+}
+
+// Add records a warning
+func (w *Warnings) Add(format string, args ...interface{}) {
+	w.messages = append(w.messages, fmt.Sprintf(format, args...))
+}
+
+// Len returns the number of warnings recorded
+func (w *Warnings) Len() int {
+	return len(w.messages)
+}
+
+// Report logs every warning
+func (w *Warnings) Report(log *slog.Logger) {
+	for _, message := range w.messages {
+		log.Warn(message)
+	}
+}
+
+// Gathers the warnings for a planned generation: thresholds the filters make unreachable,
+// thresholds that match nothing in the JSON, conflicting thresholds, containers that end up
+// with no thresholds, with -warn-duplicate-containers, containers generated more than once and,
+// with -entity-registry, references to unregistered entities
+func collectWarnings(containers []Container, config Config, plan []ContainerConfig, opts Options) *Warnings {
+	warnings := &Warnings{}
+
+	for _, problem := range unreachableThresholds(config, opts) {
+		warnings.Add("%s", problem)
+	}
+	for _, problem := range unmatchedThresholds(containers, config, opts) {
+		warnings.Add("%s", problem)
+	}
+
+	for _, planned := range plan {
+		for _, conflict := range planned.conflicts() {
+			warnings.Add("%s", conflict)
+		}
+		if planned.WriteConfig && len(planned.Config.Source.Entity.MetricThresholds) == 0 {
+			warnings.Add("container %s has no thresholds", filepath.ToSlash(planned.Path))
+		}
+	}
+
+	if opts.WarnDuplicateContainers {
+		for _, duplicate := range duplicateContainers(plan) {
+			warnings.Add("%s", duplicate)
+		}
+	}
+	if opts.registry != nil && !opts.Strict {
+		for _, problem := range unregisteredEntities(containers, config, opts.registry) {
+			warnings.Add("%s", problem)
+		}
+	}
+	return warnings
+}
+
+// Describes each container identity, its name and parent entity ID, that the plan places at
+// more than one output path, in the order the identities first appear
+func duplicateContainers(plan []ContainerConfig) []string {
+	type identity struct{ name, parentID string }
+	paths := make(map[identity][]string)
+	var order []identity
+	for _, planned := range plan {
+		id := identity{strings.TrimSpace(planned.Container.ContainerName), planned.Container.ParentEntityID}
+		path := filepath.ToSlash(planned.Path)
+		if !containsString(paths[id], path) {
+			if len(paths[id]) == 0 {
+				order = append(order, id)
+			}
+			paths[id] = append(paths[id], path)
+		}
+	}
+
+	var duplicates []string
+	for _, id := range order {
+		if len(paths[id]) > 1 {
+			duplicates = append(duplicates, fmt.Sprintf("container %q (parent entity %s) appears at %d paths: %s",
+				id.name, orDash(id.parentID), len(paths[id]), strings.Join(paths[id], ", ")))
+		}
+	}
+	return duplicates
+}
@@ -0,0 +1,139 @@
+package generator
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Writer is the destination of generated configs. Paths are relative to the output root.
+type Writer interface {
+	// WriteConfig stores a config's data at path, returning errSkipped when it deliberately leaves
+	// an existing config alone
+	WriteConfig(path string, data []byte) error
+}
+
+// dirWriter is implemented by writers with real directories, so containers that get no config
+// still get a directory
+type dirWriter interface {
+	MkdirAll(path string) error
+}
+
+// Returned by a Writer that leaves a config untouched on purpose
+var errSkipped = errors.New("config left untouched")
+
+// fsWriter writes configs under a base directory on the local filesystem
+type fsWriter struct {
+	base    string
+	dirMode os.FileMode
+	// shared holds the content hashes written once under sharedDir and linked, for -dedup-files
+	shared        map[string]bool
+	sharedWritten map[string]bool
+	// written lists every file written, relative to base, for the .generated manifest, and
+	// checksums holds their SHA-256 for -gen-checksums
+	written   []string
+	checksums map[string]string
+	// dirs holds every directory below base the writer created or wrote into, for -gen-paths
+	dirs map[string]bool
+	// owner, if set, is given every directory and file created, and owned lists the
+	// directories already given
+	owner fileOwner
+	owned map[string]bool
+	// retries is how many more times a write or mkdir failing with a transient error is tried
+	retries int
+}
+
+// Creates a filesystem writer rooted at base. Configs whose content hash is in shared are
+// written once under sharedDir and linked from each path. When owner is set, created
+// directories and files are given to it. Writes and mkdirs failing with a transient error are
+// tried up to retries more times.
+func newFSWriter(base string, dirMode os.FileMode, shared map[string]bool, owner fileOwner, retries int) *fsWriter {
+	return &fsWriter{base: base, dirMode: dirMode, shared: shared, sharedWritten: make(map[string]bool), checksums: make(map[string]string),
+		dirs: make(map[string]bool), owner: owner, owned: make(map[string]bool), retries: retries}
+}
+
+// The wait before the first retry, doubled for each one after it up to retryMaxDelay
+const (
+	retryBaseDelay = 100 * time.Millisecond
+	retryMaxDelay  = 5 * time.Second
+)
+
+// Runs op, trying it again with exponential backoff while it fails with a transient error and
+// retries remain. Other errors, like permission denied, are returned at once.
+func (w *fsWriter) retrying(action, path string, op func() error) error {
+	err := op()
+	delay := retryBaseDelay
+	for attempt := 1; attempt <= w.retries && transientFSError(err); attempt++ {
+		logger.Warn("retrying after transient error", "action", action, "path", path, "attempt", attempt, "of", w.retries, "wait", delay, "error", err)
+		time.Sleep(delay)
+		if delay *= 2; delay > retryMaxDelay {
+			delay = retryMaxDelay
+		}
+		err = op()
+	}
+	return err
+}
+
+func (w *fsWriter) MkdirAll(path string) error {
+	dir := filepath.Join(w.base, path)
+	if err := w.retrying("creating directory", dir, func() error { return os.MkdirAll(dir, w.dirMode) }); err != nil {
+		return describeFSError("creating directory", dir, err)
+	}
+	for rel := filepath.Clean(path); rel != "." && !w.dirs[rel]; rel = filepath.Dir(rel) {
+		w.dirs[rel] = true
+	}
+	return w.owner.chownDirs(w.base, path, w.owned)
+}
+
+func (w *fsWriter) WriteConfig(path string, data []byte) error {
+	yamlPath := filepath.Join(w.base, path)
+	if err := w.MkdirAll(filepath.Dir(path)); err != nil {
+		return err
+	}
+	if marker := manualOverride(filepath.Dir(yamlPath), filepath.Base(yamlPath)); marker != "" {
+		logger.Info("leaving hand-maintained config untouched", "path", yamlPath, "marker", marker)
+		return errSkipped
+	}
+
+	hash := contentHash(data)
+	w.checksums[path] = hash
+	if w.shared[hash] {
+		sharedPath := filepath.Join(w.base, sharedDir, hash[:16]+".yaml")
+		if !w.sharedWritten[hash] {
+			if err := w.MkdirAll(sharedDir); err != nil {
+				return err
+			}
+			if err := w.retrying("writing shared YAML file", sharedPath, func() error { return ioutil.WriteFile(sharedPath, data, 0644) }); err != nil {
+				return describeFSError("writing shared YAML file", sharedPath, err)
+			}
+			if err := w.owner.chown(sharedPath); err != nil {
+				return err
+			}
+			w.sharedWritten[hash] = true
+			w.written = append(w.written, filepath.Join(sharedDir, hash[:16]+".yaml"))
+			w.checksums[filepath.Join(sharedDir, hash[:16]+".yaml")] = hash
+		}
+		if err := w.retrying("linking shared YAML file", yamlPath, func() error { return linkShared(sharedPath, yamlPath, data) }); err != nil {
+			return describeFSError("linking shared YAML file", yamlPath, err)
+		}
+		if err := w.owner.chown(yamlPath); err != nil {
+			return err
+		}
+		w.written = append(w.written, path)
+		return nil
+	}
+
+	if err := removeLink(yamlPath); err != nil {
+		return describeFSError("replacing shared YAML link", yamlPath, err)
+	}
+	if err := w.retrying("writing YAML file", yamlPath, func() error { return ioutil.WriteFile(yamlPath, data, 0644) }); err != nil {
+		return describeFSError("writing YAML file", yamlPath, err)
+	}
+	if err := w.owner.chown(yamlPath); err != nil {
+		return err
+	}
+	w.written = append(w.written, path)
+	return nil
+}
@@ -0,0 +1,10 @@
+module github.com/pchhabra11/amexTest
+
+go 1.26.0
+
+require (
+	go.yaml.in/yaml/v3 v3.0.5
+	golang.org/x/term v0.46.0
+)
+
+require golang.org/x/sys v0.48.0 // indirect
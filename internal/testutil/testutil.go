@@ -0,0 +1,124 @@
+// Package testutil builds generator inputs for tests, so a fixture reads as the containers
+// and thresholds it holds rather than as nested struct literals.
+package testutil
+
+import "github.com/pchhabra11/amexTest/generator"
+
+// ContainerBuilder builds a generator.Container. Metadata goes into the most recently added
+// graph, and nested containers into the most recently added metadata.
+type ContainerBuilder struct {
+	container generator.Container
+}
+
+// NewContainer starts a container with the given name and no graphs
+func NewContainer(name string) *ContainerBuilder {
+	return &ContainerBuilder{container: generator.Container{ContainerName: name}}
+}
+
+// WithParent sets the container's parent entity ID
+func (b *ContainerBuilder) WithParent(entityID string) *ContainerBuilder {
+	b.container.ParentEntityID = entityID
+	return b
+}
+
+// WithGraph adds an empty graph
+func (b *ContainerBuilder) WithGraph(name string) *ContainerBuilder {
+	b.container.Graphs = append(b.container.Graphs, generator.Graph{GraphName: name})
+	return b
+}
+
+// WithMeta adds graph metadata for an entity/metric pair, to a graph named "graph" when none
+// has been added yet
+func (b *ContainerBuilder) WithMeta(entity, metric string) *ContainerBuilder {
+	return b.WithLegend(entity, metric, "")
+}
+
+// WithLegend adds graph metadata like WithMeta, with a legend name
+func (b *ContainerBuilder) WithLegend(entity, metric, legend string) *ContainerBuilder {
+	if len(b.container.Graphs) == 0 {
+		b.WithGraph("graph")
+	}
+	graph := &b.container.Graphs[len(b.container.Graphs)-1]
+	graph.GraphMetadata = append(graph.GraphMetadata, generator.GraphMeta{EntityID: entity, MetricID: metric, LegendName: legend})
+	return b
+}
+
+// WithNested adds containers to the layout of the last metadata, adding metadata for the
+// pair entity/metric when there is none yet
+func (b *ContainerBuilder) WithNested(nested ...*ContainerBuilder) *ContainerBuilder {
+	if len(b.container.Graphs) == 0 || len(b.container.Graphs[len(b.container.Graphs)-1].GraphMetadata) == 0 {
+		b.WithMeta("entity", "metric")
+	}
+	graph := &b.container.Graphs[len(b.container.Graphs)-1]
+	layout := &graph.GraphMetadata[len(graph.GraphMetadata)-1].MetadataLayout
+	for _, child := range nested {
+		layout.Containers = append(layout.Containers, child.Build())
+	}
+	return b
+}
+
+// Build returns the container
+func (b *ContainerBuilder) Build() generator.Container {
+	return b.container
+}
+
+// ConfigBuilder builds a generator.Config
+type ConfigBuilder struct {
+	config generator.Config
+}
+
+// NewConfig starts a config whose defaultConfig passes validation, with no thresholds
+func NewConfig() *ConfigBuilder {
+	return &ConfigBuilder{config: generator.Config{Source: generator.Source{
+		DefaultConfig: generator.DefaultConfig{
+			EmailConfigName:            "email",
+			IncidentSevTwoConfigName:   "sev2",
+			IncidentSevThreeConfigName: "sev3",
+			IncidentSevFourConfigName:  "sev4",
+			Incident:                   generator.Incident{Severity: "sev3"},
+		},
+		Entity: generator.Entity{Name: "service", ID: "service"},
+	}}}
+}
+
+// WithThreshold adds a threshold for an entity/metric pair with the given bounds, which
+// Bound and Unbounded help write
+func (b *ConfigBuilder) WithThreshold(entity, metric string, min, max *float64) *ConfigBuilder {
+	return b.With(generator.MetricThreshold{EntityID: entity, MetricID: metric, Min: min, Max: max})
+}
+
+// WithGraphThreshold adds a graph-level threshold, applying to every metric of the named graph
+func (b *ConfigBuilder) WithGraphThreshold(graph string, min, max *float64) *ConfigBuilder {
+	return b.With(generator.MetricThreshold{GraphName: graph, Min: min, Max: max})
+}
+
+// With adds a threshold as given
+func (b *ConfigBuilder) With(threshold generator.MetricThreshold) *ConfigBuilder {
+	b.config.Source.Entity.MetricThresholds = append(b.config.Source.Entity.MetricThresholds, threshold)
+	return b
+}
+
+// WithIgnored adds entity IDs to the ignore block
+func (b *ConfigBuilder) WithIgnored(entityIDs ...string) *ConfigBuilder {
+	b.config.Source.Entity.Ignore.EntityIds = append(b.config.Source.Entity.Ignore.EntityIds, entityIDs...)
+	return b
+}
+
+// WithWhitelisted adds entity IDs to the whitelist block
+func (b *ConfigBuilder) WithWhitelisted(entityIDs ...string) *ConfigBuilder {
+	b.config.Source.Entity.Whitelist.EntityIds = append(b.config.Source.Entity.Whitelist.EntityIds, entityIDs...)
+	return b
+}
+
+// Build returns the config
+func (b *ConfigBuilder) Build() generator.Config {
+	return b.config
+}
+
+// Bound returns a pointer to value, for a threshold's min or max
+func Bound(value float64) *float64 {
+	return &value
+}
+
+// Unbounded leaves a threshold's min or max unset
+var Unbounded *float64
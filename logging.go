@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// logger receives the command's own events; main configures it, and the generator's, from
+// -log-format and -log-level
+var logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+// Builds a stderr logger in text or JSON format. quiet raises the level to warnings.
+func newLogger(format, level string, quiet bool) (*slog.Logger, error) {
+	var minLevel slog.Level
+	if err := minLevel.UnmarshalText([]byte(strings.ToUpper(level))); err != nil {
+		return nil, fmt.Errorf("unknown -log-level %q", level)
+	}
+	if quiet && minLevel < slog.LevelWarn {
+		minLevel = slog.LevelWarn
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: minLevel}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, handlerOpts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, handlerOpts)), nil
+	}
+	return nil, fmt.Errorf("unknown -log-format %q", format)
+}
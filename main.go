@@ -1,223 +1,298 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"gopkg.in/yaml.v2"
-	"io/ioutil"
 	"os"
-	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/pchhabra11/amexTest/generator"
 )
 
-// JSON structures remain unchanged
-type Response struct {
-	Status  int    `json:"status"`
-	Message string `json:"message"`
-	Data    Data   `json:"data"`
-}
+// stringList is a flag.Value collecting every occurrence of a repeatable flag
+type stringList []string
 
-type Data struct {
-	Containers []Container `json:"containers"`
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
 }
 
-type Container struct {
-	ParentEntityID string  `json:"parent_entity_id"`
-	ContainerName  string  `json:"container_name"`
-	Graphs         []Graph `json:"graphs"`
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
 }
 
-type Graph struct {
-	GraphName     string      `json:"graph_name"`
-	GraphMetadata []GraphMeta `json:"graph_metadata"`
+// outList is the flag.Value of -out: the first occurrence replaces the default output
+// directory, and each later one adds a mirror getting the same tree
+type outList struct {
+	gen  *generator.Generation
+	opts *generator.Options
+	set  bool
 }
 
-type GraphMeta struct {
-	LegendName     string         `json:"legend_name"`
-	EntityID       string         `json:"entity_id"`
-	MetricID       string         `json:"metric_id"`
-	MetadataLayout MetadataLayout `json:"metadata_layout"`
+func (l *outList) String() string {
+	if l == nil || l.gen == nil {
+		return ""
+	}
+	return strings.Join(append([]string{l.gen.Out}, l.opts.Mirrors...), ",")
 }
 
-type MetadataLayout struct {
-	Containers []Container `json:"containers"`
+func (l *outList) Set(value string) error {
+	if !l.set {
+		l.gen.Out, l.set = value, true
+	} else {
+		l.opts.Mirrors = append(l.opts.Mirrors, value)
+	}
+	return nil
 }
 
-// YAML structures
-type Config struct {
-	Source Source `yaml:"source"`
-}
+// Exit status when -timeout cancels the run, distinct from ordinary failures
+const exitTimeout = 3
 
-type Source struct {
-	DefaultConfig DefaultConfig `yaml:"defaultConfig"`
-	Entity        Entity        `yaml:"entity"`
+// Invocation-wide settings, as opposed to the Options of each generation
+type globalFlags struct {
+	manifest, batch, chdir                      string
+	logFormat, logLevel, cpuProfile, memProfile string
+	batchParallel                               int
 }
 
-type DefaultConfig struct {
-	EmailConfigName            string   `yaml:"emailConfigName"`
-	SlackConfigName            string   `yaml:"slackConfigName"`
-	IncidentSevTwoConfigName   string   `yaml:"incidentSevTwoConfigName"`
-	IncidentSevThreeConfigName string   `yaml:"incidentSevThreeConfigName"`
-	IncidentSevFourConfigName  string   `yaml:"incidentSevFourConfigName"`
-	Incident                   Incident `yaml:"incident"`
-}
+// flagGroup registers a related set of flags on fs, storing each generation's settings in
+// opts and gen and the invocation-wide ones in global. The flags default to opts' current
+// values, normally generator.DefaultOptions.
+type flagGroup func(fs *flag.FlagSet, opts *generator.Options, gen *generator.Generation, global *globalFlags)
 
-type Incident struct {
-	Severity string `yaml:"severity"`
-	Enabled  bool   `yaml:"enabled"`
-}
+// Every flag group; generate and the generations of a manifest take them all
+var allFlagGroups = []flagGroup{globalFlagGroup, inputFlags, validationFlags, planFlags, checkFlags, reportFlags, outlineFlags, baselineFlags, writeFlags}
 
-type Entity struct {
-	Name             string            `yaml:"name"`
-	ID               string            `yaml:"id"`
-	Ignore           EntityIDs         `yaml:"ignore"`
-	Whitelist        EntityIDs         `yaml:"whitelist"`
-	MetricThresholds []MetricThreshold `yaml:"metricThresholds"`
+// Registers the flags of groups on fs
+func defineFlags(fs *flag.FlagSet, groups []flagGroup, opts *generator.Options, gen *generator.Generation, global *globalFlags) {
+	for _, define := range groups {
+		define(fs, opts, gen, global)
+	}
 }
 
-type EntityIDs struct {
-	EntityIds []string `yaml:"entityIds"`
+// Registers the invocation-wide flags every command takes
+func globalFlagGroup(fs *flag.FlagSet, opts *generator.Options, gen *generator.Generation, global *globalFlags) {
+	fs.StringVar(&global.logFormat, "log-format", "text", "log format on stderr: text or json")
+	fs.StringVar(&global.logLevel, "log-level", "info", "minimum log level: debug, info, warn or error")
+	fs.StringVar(&global.chdir, "chdir", "", "change to this directory before resolving any input or output paths")
+	fs.StringVar(&global.manifest, "manifest", "", "generate.yaml manifest listing several json/yaml/out generations to run; overrides -json, -yaml and -out")
+	fs.StringVar(&global.batch, "batch", "", "manifest of generations, each with optional flags of its own, to run to completion even when some fail, reporting every one's result")
+	fs.IntVar(&global.batchParallel, "batch-parallel", 1, "with -batch, the number of generations to run at once")
+	fs.DurationVar(&opts.Timeout, "timeout", opts.Timeout, "abort the whole run, exiting with status 3, if it takes longer than this (0 for no limit)")
+	fs.BoolVar(&opts.Quiet, "quiet", opts.Quiet, "suppress progress and success output")
+	fs.StringVar(&global.cpuProfile, "cpuprofile", "", "write a pprof CPU profile of the run to this file")
+	fs.StringVar(&global.memProfile, "memprofile", "", "write a pprof heap profile to this file when the run ends")
 }
 
-type MetricThreshold struct {
-	EntityID       string   `yaml:"entityId"`
-	MetricID       string   `yaml:"metricId"`
-	ParentEntityID string   `yaml:"parentEntityId"`
-	ContainerName  string   `yaml:"containerName"`
-	GraphName      string   `yaml:"graphName"`
-	LegendName     string   `yaml:"legendName"`
-	Min            *float64 `yaml:"min,omitempty"`
-	Max            *float64 `yaml:"max,omitempty"`
-	Incident       string   `yaml:"incident,omitempty"`
+// Registers the flags locating and decoding the JSON and YAML inputs
+func inputFlags(fs *flag.FlagSet, opts *generator.Options, gen *generator.Generation, global *globalFlags) {
+	fs.StringVar(&gen.JSON, "json", "test-1.json", "JSON layout input file, or a directory whose *.json files all contribute containers")
+	fs.StringVar(&gen.YAML, "yaml", "test-2.yaml", "YAML threshold config input file")
+	fs.StringVar(&opts.JSONEnv, "json-env", opts.JSONEnv, "environment variable holding the base64-encoded JSON input; overrides -json")
+	fs.StringVar(&opts.YAMLEnv, "yaml-env", opts.YAMLEnv, "environment variable holding the base64-encoded YAML input; overrides -yaml")
+	fs.BoolVar(&opts.Normalize, "normalize", opts.Normalize, "trim surrounding whitespace from names, IDs and severities in both inputs before matching")
+	fs.StringVar(&opts.DataField, "data-field", opts.DataField, "JSON envelope key holding the object with the containers array, like payload (default data)")
+	fs.StringVar(&opts.ContainersField, "containers-field", opts.ContainersField, "key of the containers array within the envelope's data object, like items (default containers)")
+	fs.StringVar(&opts.JSONPath, "json-path", opts.JSONPath, "dotted path of object keys to the containers array in the JSON, like data.region.containers (default data.containers)")
+	fs.BoolVar(&opts.AllowEmptyDefaults, "allow-empty-defaults", opts.AllowEmptyDefaults, "allow empty notification config names in defaultConfig")
 }
 
-// Function to create directory structure and generate YAML files
-func createStructureAndYaml(basePath string, containers []Container, yamlConfig Config) error {
-	for _, container := range containers {
-		sanitizedName := sanitizeFolderName(container.ContainerName)
-		currentPath := filepath.Join(basePath, sanitizedName)
-
-		if err := os.MkdirAll(currentPath, 0755); err != nil {
-			return fmt.Errorf("error creating directory %s: %v", currentPath, err)
-		}
-
-		// Create YAML file for this container
-		containerYaml := createContainerYaml(yamlConfig, container)
-		yamlData, err := yaml.Marshal(containerYaml)
-		if err != nil {
-			return fmt.Errorf("error marshaling YAML for %s: %v", container.ContainerName, err)
-		}
+// Registers the checks of the inputs themselves
+func validationFlags(fs *flag.FlagSet, opts *generator.Options, gen *generator.Generation, global *globalFlags) {
+	fs.StringVar(&opts.EntityRegistry, "entity-registry", opts.EntityRegistry, "file listing the valid entity IDs, one per line; thresholds and containers referencing any other entity are warned about")
+	fs.BoolVar(&opts.CheckParents, "check-parents", opts.CheckParents, "verify every nested container's parent_entity_id matches the graph metadata that encloses it")
+}
 
-		yamlPath := filepath.Join(currentPath, "config.yaml")
-		if err := ioutil.WriteFile(yamlPath, yamlData, 0644); err != nil {
-			return fmt.Errorf("error writing YAML file %s: %v", yamlPath, err)
-		}
+// Registers the flags shaping the planned tree and its thresholds
+func planFlags(fs *flag.FlagSet, opts *generator.Options, gen *generator.Generation, global *globalFlags) {
+	gen.Out = "monitoring_structure"
+	fs.Var(&outList{gen: gen, opts: opts}, "out", "base directory for the generated structure; repeat it to write the same tree into each directory")
+	fs.StringVar(&opts.Env, "env", opts.Env, "environment name; output is written under a subfolder of this name")
+	fs.StringVar(&opts.ChangedFile, "changed-file", opts.ChangedFile, "file listing changed container names (or parent entity IDs, see -match-field), one per line; only they and their nested containers are regenerated")
+	fs.Var((*stringList)(&opts.Only), "only", "generate only the container with this name (or parent entity ID, see -match-field), without its nested containers (repeatable)")
+	fs.StringVar(&opts.MatchField, "match-field", opts.MatchField, "container field -only and -changed-file entries are matched against: name or parent-id")
+	fs.IntVar(&opts.MinGraphs, "min-graphs", opts.MinGraphs, "skip containers with fewer graphs than this; they get a directory only when a nested container is written")
+	fs.BoolVar(&opts.NoRecurse, "no-recurse", opts.NoRecurse, "generate only the top-level containers, ignoring nested ones")
+	fs.BoolVar(&opts.FoldNested, "fold-nested", opts.FoldNested, "with -no-recurse, add the nested containers' thresholds to their top-level container instead of dropping them")
+	fs.StringVar(&opts.FilenamePrefix, "filename-prefix", opts.FilenamePrefix, "prefix for generated config file names, like 10- for 10-config.yaml; letters, digits, '.', '_' and '-' only")
+	fs.BoolVar(&opts.LeavesOnly, "leaves-only", opts.LeavesOnly, "write config.yaml only for leaf containers; intermediate containers get just a directory")
+	fs.Var((*stringList)(&opts.StripPrefixes), "strip-prefix", "prefix to remove from container names before building folder names (repeatable)")
+	fs.StringVar(&opts.GroupBy, "group-by", opts.GroupBy, "output layout: empty for container nesting, or parent for one folder per parent entity ID")
+	fs.BoolVar(&opts.Inherit, "inherit", opts.Inherit, "nested containers inherit their parent's thresholds for entity/metric pairs they don't match themselves")
+	fs.BoolVar(&opts.ScaffoldWhitelist, "scaffold-whitelist", opts.ScaffoldWhitelist, "add a placeholder threshold without bounds, commented TODO, to each config for the container's entity/metric pairs whose entity is whitelisted but gets no threshold")
+	fs.Var((*stringList)(&opts.Passthrough), "passthrough", "extra container JSON field to copy into the generated config's metadata (repeatable)")
+	fs.StringVar(&opts.Severity, "severity", opts.Severity, "only emit thresholds whose resolved incident severity is this (sev2, sev3 or sev4)")
+	fs.Var((*stringList)(&opts.ExcludeMetrics), "exclude-metric", "metric ID that never gets a threshold, regardless of the YAML (repeatable)")
+	fs.BoolVar(&opts.MergeThresholds, "merge-thresholds", opts.MergeThresholds, "combine thresholds for the same entity/metric in a container, including those -inherit or -fold-nested bring in, into the tightest bounds and most severe incident, instead of keeping the first; graph-level thresholds are never merged, applying only where no specific threshold matches")
+	fs.Float64Var(&opts.ThresholdScale, "threshold-scale", opts.ThresholdScale, "loosen every emitted bound by this factor, for non-prod environments: max is multiplied by it and min divided by it (the other way round for negative bounds); below 1 tightens instead")
+	fs.StringVar(&opts.ThresholdScaleBounds, "threshold-scale-bounds", opts.ThresholdScaleBounds, "bounds -threshold-scale applies to: both, max or min")
+	fs.BoolVar(&opts.DropEmptyThresholds, "drop-empty-thresholds", opts.DropEmptyThresholds, "leave out matched thresholds that have neither min nor max, even after defaultConfig bounds, instead of emitting empty entries")
+	fs.BoolVar(&opts.SourceNames, "source-names", opts.SourceNames, "set each emitted threshold's graphName and legendName from the JSON graph and legend it matched")
+	fs.Var(&opts.DedupKey, "dedup-key", "comma-separated threshold fields identifying a threshold within a container: entity, metric, legend and graph")
+	fs.StringVar(&opts.SortBy, "sort-by", opts.SortBy, "threshold order in each config: empty for match order, or severity for sev2 first, then sev3, sev4 and unspecified")
+	fs.BoolVar(&opts.PreserveOrder, "preserve-order", opts.PreserveOrder, "process sibling containers in input order instead of sorted by folder name")
+	fs.StringVar(&opts.SortContainers, "sort-containers", opts.SortContainers, "sibling container order: input, name (container name), parent-id or entity-count (most distinct entities first); ties keep input order (default sorted by folder name)")
+}
 
-		// Process nested containers
-		for _, graph := range container.Graphs {
-			for _, meta := range graph.GraphMetadata {
-				if meta.MetadataLayout.Containers != nil {
-					if err := createStructureAndYaml(currentPath, meta.MetadataLayout.Containers, yamlConfig); err != nil {
-						return err
-					}
-				}
-			}
-		}
-	}
-	return nil
+// Registers the checks of the planned tree
+func checkFlags(fs *flag.FlagSet, opts *generator.Options, gen *generator.Generation, global *globalFlags) {
+	fs.Float64Var(&opts.MinCoverage, "min-coverage", opts.MinCoverage, "fail when less than this fraction (0 to 1) of the JSON's distinct entity/metric pairs get a threshold")
+	fs.BoolVar(&opts.WarnDuplicateContainers, "warn-duplicate-containers", opts.WarnDuplicateContainers, "warn about containers, by name and parent entity ID, that are generated at more than one path")
+	fs.BoolVar(&opts.Strict, "strict", opts.Strict, "fail on conflicting thresholds, and entities missing from -entity-registry, instead of warning")
+	fs.BoolVar(&opts.FailOnWarnings, "fail-on-warnings", opts.FailOnWarnings, "treat every warning as an error")
 }
 
-// Creates a YAML configuration tailored to a specific container
-func createContainerYaml(config Config, container Container) Config {
-	newConfig := Config{
-		Source: Source{
-			DefaultConfig: config.Source.DefaultConfig,
-			Entity: Entity{
-				Name:      config.Source.Entity.Name,
-				ID:        config.Source.Entity.ID,
-				Ignore:    config.Source.Entity.Ignore,
-				Whitelist: config.Source.Entity.Whitelist,
-			},
-		},
-	}
-
-	// Deduplicate based solely on entityId and metricId combinations
-	uniqueThresholds := make(map[string]MetricThreshold)
-
-	for _, graph := range container.Graphs {
-		for _, meta := range graph.GraphMetadata {
-			for _, threshold := range config.Source.Entity.MetricThresholds {
-				if threshold.EntityID == meta.EntityID && threshold.MetricID == meta.MetricID {
-					key := threshold.EntityID + "-" + threshold.MetricID
-
-					// Only add if this unique combination of entityId and metricId has not been added before
-					if _, exists := uniqueThresholds[key]; !exists {
-						uniqueThresholds[key] = threshold
-					}
-				}
-			}
-		}
-	}
+// Registers the flags choosing how a report is printed
+func reportFlags(fs *flag.FlagSet, opts *generator.Options, gen *generator.Generation, global *globalFlags) {
+	fs.StringVar(&opts.Format, "format", opts.Format, "output format: yaml (config.yaml per container), multi-yaml (one YAML stream with a document per container), text (one line per threshold), csv (one row per threshold), kv (key=value lines per threshold bound) or prom (Prometheus alerting rules); with -dry-run also json; with -baseline, yaml or json")
+	fs.StringVar(&opts.OutputFile, "output-file", opts.OutputFile, "file to write single-file formats to (default stdout)")
+}
 
-	// Append the unique thresholds to newConfig
-	for _, threshold := range uniqueThresholds {
-		newConfig.Source.Entity.MetricThresholds = append(newConfig.Source.Entity.MetricThresholds, threshold)
-	}
+// Registers the -dry-run outline's flags
+func outlineFlags(fs *flag.FlagSet, opts *generator.Options, gen *generator.Generation, global *globalFlags) {
+	fs.BoolVar(&opts.NoColor, "no-color", opts.NoColor, "don't color the -dry-run outline, even on a terminal (also off when $NO_COLOR is set)")
+}
 
-	return newConfig
+// Registers the flags of comparing with a baseline tree
+func baselineFlags(fs *flag.FlagSet, opts *generator.Options, gen *generator.Generation, global *globalFlags) {
+	fs.StringVar(&opts.Baseline, "baseline", opts.Baseline, "directory of previously generated configs; print the per-container threshold diff instead of generating")
+	fs.IntVar(&opts.Indent, "indent", opts.Indent, "spaces per indentation level in generated YAML")
 }
 
-// Sanitizes folder names to ensure compatibility with file system restrictions
-func sanitizeFolderName(name string) string {
-	invalid := []string{"/", "\\", ":", "*", "?", "\"", "<", ">", "|"}
-	result := name
-	for _, char := range invalid {
-		result = strings.ReplaceAll(result, char, "_")
-	}
-	return result
+// Registers the flags of writing the tree and of generate's other modes
+func writeFlags(fs *flag.FlagSet, opts *generator.Options, gen *generator.Generation, global *globalFlags) {
+	fs.BoolVar(&opts.Stdout, "stdout", opts.Stdout, "write the config of the single selected container (see -only) to stdout instead of a file")
+	fs.BoolVar(&opts.GroupByGraph, "group-by-graph", opts.GroupByGraph, "in generated YAML, replace the metricThresholds list with graphs: {graphName: {thresholds: [...]}} by the JSON graph each threshold matched in")
+	fs.StringVar(&opts.PromExpr, "prom-expr", opts.PromExpr, "text/template for the series selector in -format prom; fields are the threshold's plus Path, and quote makes a value a PromQL string")
+	fs.Var(&opts.DirMode, "dir-mode", "octal permissions for created directories")
+	fs.Var(&opts.Owner, "owner", "numeric uid:gid to chown created directories and config files to, such as 1000:1000 (ignored with a warning where unsupported)")
+	fs.IntVar(&opts.MaxFiles, "max-files", opts.MaxFiles, "abort without writing if more than this many config files would be generated (0 for no limit)")
+	fs.BoolVar(&opts.Clean, "clean", opts.Clean, "after writing, remove files the previous run generated (per the .generated manifest) that this run no longer does, asking first unless -assume-yes")
+	fs.BoolVar(&opts.AssumeYes, "assume-yes", opts.AssumeYes, "answer yes to confirmations such as -clean's; without it they are skipped when stdin isn't a terminal")
+	fs.BoolVar(&opts.DedupFiles, "dedup-files", opts.DedupFiles, "write configs identical across containers once under _shared and symlink each container's config to it (copies where links aren't supported)")
+	fs.BoolVar(&opts.VerifyPaths, "verify-paths", opts.VerifyPaths, "after writing, check that every planned directory and config file exists and is non-empty")
+	fs.BoolVar(&opts.GenGitignore, "gen-gitignore", opts.GenGitignore, "write a .gitignore at the output root listing the generated files")
+	fs.StringVar(&opts.GitignoreTemplate, "gitignore-template", opts.GitignoreTemplate, "text/template file for -gen-gitignore's content; .Patterns lists the generated file patterns")
+	fs.BoolVar(&opts.GenChecksums, "gen-checksums", opts.GenChecksums, "write checksums.txt at the output root with the SHA-256 of every generated file, in sha256sum format")
+	fs.StringVar(&opts.GenPaths, "gen-paths", opts.GenPaths, "write generated-paths.txt at the output root listing every generated file and directory, one per line, as relative or absolute paths")
+	fs.BoolVar(&opts.GenIndex, "gen-index", opts.GenIndex, "write index.yaml at the output root mapping each entity ID to the container paths with a threshold for it (only the containers this run writes)")
+	fs.StringVar(&opts.PostHook, "post-hook", opts.PostHook, "command to run after each successful generation; the absolute output path is appended as an argument and set in $GENERATED_OUT")
+	fs.Float64Var(&opts.WriteRate, "write-rate", opts.WriteRate, "maximum config files written per second (0 for unlimited)")
+	fs.Var((*stringList)(&opts.Archives), "archive", "also write every generated config into this zip archive, alongside the output tree (repeatable)")
+	fs.IntVar(&opts.Retry, "retry", opts.Retry, "retry file writes and directory creation up to this many times, with exponential backoff, when they fail with a transient error like EIO")
+	fs.BoolVar(&opts.JSONSummary, "json-summary", opts.JSONSummary, "on completion print a JSON object with the output path, counts and duration instead of the success message")
+	fs.BoolVar(&opts.DryRun, "dry-run", opts.DryRun, "print the planned tree instead of writing it; with -format json, print it as a JSON document")
+	fs.StringVar(&opts.Explain, "explain", opts.Explain, "trace entity=E,metric=M through matching: its YAML thresholds, the filters on it and the containers it lands in, without writing files")
+	fs.BoolVar(&opts.Scaffold, "scaffold", opts.Scaffold, "print a starter YAML config with an empty threshold for every entity/metric in the JSON, instead of generating; -yaml is not read")
+	fs.BoolVar(&opts.ValidateOnly, "validate-only", opts.ValidateOnly, "check the inputs and report every problem without generating output")
+	fs.BoolVar(&opts.Audit, "audit", opts.Audit, "check the existing output tree against the inputs and report missing, extra and changed files as YAML or JSON (see -format), failing if there are any; nothing is written")
 }
 
 func main() {
-	// Read JSON file
-	jsonFile, err := os.ReadFile("test-1.json")
+	opts := generator.DefaultOptions()
+	var gen generator.Generation
+	var global globalFlags
+	cmd, args, err := parseCommand(os.Args[1:])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	name := os.Args[0]
+	if len(args) < len(os.Args)-1 {
+		name += " " + cmd.name
+	}
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	defineFlags(fs, cmd.groups, &opts, &gen, &global)
+	fs.Usage = cmd.usage(fs)
+	args, err = cmd.parse(fs, &opts, args)
 	if err != nil {
-		fmt.Printf("Error reading JSON file: %v\n", err)
-		return
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	if err := opts.Validate(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	if err := global.validate(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
 	}
 
-	// Read YAML file
-	yamlFile, err := os.ReadFile("test-2.yaml")
+	configuredLogger, err := newLogger(global.logFormat, global.logLevel, opts.Quiet)
 	if err != nil {
-		fmt.Printf("Error reading YAML file: %v\n", err)
-		return
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
 	}
+	logger = configuredLogger
+	generator.SetLogger(logger)
 
-	// Parse JSON
-	var response Response
-	if err := json.Unmarshal(jsonFile, &response); err != nil {
-		fmt.Printf("Error parsing JSON: %v\n", err)
-		return
+	if global.chdir != "" {
+		if err := os.Chdir(global.chdir); err != nil {
+			fmt.Printf("Error: changing directory: %v\n", err)
+			os.Exit(1)
+		}
 	}
 
-	// Parse YAML using the updated Config struct
-	var yamlConfig Config
-	if err := yaml.Unmarshal(yamlFile, &yamlConfig); err != nil {
-		fmt.Printf("Error parsing YAML: %v\n", err)
-		return
+	generations := []manifestGeneration{{Generation: gen}}
+	manifestPath := global.manifest
+	if global.batch != "" {
+		manifestPath = global.batch
+	}
+	if manifestPath != "" {
+		manifest, err := loadManifest(manifestPath)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(opts.Mirrors) > 0 {
+			fmt.Println("Error: -manifest and -batch give every generation its own out; -out can't be repeated with them")
+			os.Exit(2)
+		}
+		generations = manifest.Generations
+	}
+	jobs, err := generationJobs(generations, opts, args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
 	}
 
-	// Create base directory
-	basePath := "monitoring_structure"
-	if err := os.MkdirAll(basePath, 0755); err != nil {
-		fmt.Printf("Error creating base directory: %v\n", err)
-		return
+	ctx := context.Background()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
 	}
 
-	// Create folder structure and YAML files
-	if err := createStructureAndYaml(basePath, response.Data.Containers, yamlConfig); err != nil {
-		fmt.Printf("Error creating structure: %v\n", err)
-		return
+	stopProfiling, err := startProfiling(global.cpuProfile, global.memProfile)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	var code int
+	if global.batch != "" {
+		code = runBatch(ctx, jobs, global.batchParallel, opts)
+	} else {
+		code = runGenerations(ctx, jobs, opts.Timeout)
 	}
+	stopProfiling()
+	os.Exit(code)
+}
 
-	fmt.Println("Folder structure and YAML files created successfully!")
+// Runs each generation in turn, stopping at the first failure, and returns the exit status
+func runGenerations(ctx context.Context, jobs []job, timeout time.Duration) int {
+	for i, job := range jobs {
+		if err := generator.Run(ctx, job.Generation, job.opts, &generator.GenerationStats{}); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				fmt.Printf("Timed out after %s with %d of %d generations complete\n", timeout, i, len(jobs))
+				return exitTimeout
+			}
+			return 1
+		}
+	}
+	return 0
 }
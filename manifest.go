@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/pchhabra11/amexTest/generator"
+	"go.yaml.in/yaml/v3"
+)
+
+// manifestGeneration is a generation as a manifest lists it
+type manifestGeneration struct {
+	generator.Generation `yaml:",inline"`
+	// Flags are extra command-line flags for this generation alone, applied after the
+	// invocation's own; -json, -yaml, -out and the invocation-wide flags can't be set here
+	Flags []string `yaml:"flags,omitempty"`
+}
+
+// Manifest lists several generations to run in one invocation, typically from a
+// //go:generate directive such as:
+//
+//	//go:generate go run . -manifest generate.yaml
+//
+// A generate.yaml looks like:
+//
+//	generations:
+//	  - json: team-a/layout.json
+//	    yaml: team-a/thresholds.yaml
+//	    out: monitoring_structure/team-a
+//	  - json: team-b/layout.json
+//	    yaml: team-b/thresholds.yaml
+//	    out: monitoring_structure/team-b
+//
+// The json, yaml and out fields are required. Paths are relative to the working
+// directory, and all other command-line flags apply to every generation unless its
+// flags list overrides them:
+//
+//   - json: team-c/layout.json
+//     yaml: team-c/thresholds.yaml
+//     out: monitoring_structure/team-c
+//     flags: [-leaves-only, -severity, sev2]
+type Manifest struct {
+	Generations []manifestGeneration `yaml:"generations"`
+}
+
+// Loads and checks a generation manifest
+func loadManifest(path string) (Manifest, error) {
+	var manifest Manifest
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return manifest, fmt.Errorf("reading manifest: %v", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&manifest); err != nil {
+		return manifest, fmt.Errorf("parsing manifest %s: %v", path, err)
+	}
+
+	if len(manifest.Generations) == 0 {
+		return manifest, fmt.Errorf("manifest %s lists no generations", path)
+	}
+	for i, gen := range manifest.Generations {
+		if gen.JSON == "" || gen.YAML == "" || gen.Out == "" {
+			return manifest, fmt.Errorf("manifest %s: generation %d must set json, yaml and out", path, i+1)
+		}
+	}
+	return manifest, nil
+}
+
+// Flags that either come from a generation's manifest fields or apply to the whole
+// invocation, so a generation's flags list can't set them
+var invocationFlags = map[string]bool{
+	"json": true, "yaml": true, "out": true, "manifest": true, "batch": true, "batch-parallel": true,
+	"chdir": true, "log-format": true, "log-level": true, "cpuprofile": true, "memprofile": true, "timeout": true,
+}
+
+// job is a generation together with the options it runs with
+type job struct {
+	generator.Generation
+	opts generator.Options
+}
+
+// Resolves the options of every generation, layering each one's flags over the
+// command line's args
+func generationJobs(generations []manifestGeneration, opts generator.Options, args []string) ([]job, error) {
+	jobs := make([]job, len(generations))
+	for i, gen := range generations {
+		jobs[i] = job{Generation: gen.Generation, opts: opts}
+		if len(gen.Flags) == 0 {
+			continue
+		}
+		genOpts, err := generationOptions(gen, args)
+		if err != nil {
+			return nil, fmt.Errorf("generation %d (%s): %v", i+1, gen.Out, err)
+		}
+		jobs[i].opts = genOpts
+	}
+
+	// Generations sharing an archive would overwrite each other's
+	archivedBy := make(map[string]string)
+	for _, job := range jobs {
+		for _, archive := range job.opts.Archives {
+			path := filepath.Clean(archive)
+			if other, taken := archivedBy[path]; taken {
+				return nil, fmt.Errorf("generations %s and %s both write archive %s; give each its own -archive in its flags", other, job.Out, archive)
+			}
+			archivedBy[path] = job.Out
+		}
+	}
+	return jobs, nil
+}
+
+// Parses args and then the generation's own flags into a fresh set of options
+func generationOptions(gen manifestGeneration, args []string) (generator.Options, error) {
+	// Parse the generation's flags alone first, to find any it isn't allowed to set
+	own := flag.NewFlagSet(gen.Out, flag.ContinueOnError)
+	own.SetOutput(ioutil.Discard)
+	ownOpts := generator.DefaultOptions()
+	defineFlags(own, allFlagGroups, &ownOpts, &generator.Generation{}, &globalFlags{})
+	if err := own.Parse(gen.Flags); err != nil {
+		return generator.Options{}, err
+	}
+	if own.NArg() > 0 {
+		return generator.Options{}, fmt.Errorf("unexpected argument %q in flags", own.Arg(0))
+	}
+	var disallowed []string
+	own.Visit(func(f *flag.Flag) {
+		if invocationFlags[f.Name] {
+			disallowed = append(disallowed, "-"+f.Name)
+		}
+	})
+	if len(disallowed) > 0 {
+		return generator.Options{}, fmt.Errorf("%s can't be set per generation", strings.Join(disallowed, ", "))
+	}
+
+	opts := generator.DefaultOptions()
+	fs := flag.NewFlagSet(gen.Out, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	defineFlags(fs, allFlagGroups, &opts, &generator.Generation{}, &globalFlags{})
+	if err := fs.Parse(args); err != nil {
+		return generator.Options{}, err
+	}
+	if err := fs.Parse(gen.Flags); err != nil {
+		return generator.Options{}, err
+	}
+	if err := opts.Validate(); err != nil {
+		return generator.Options{}, err
+	}
+	return opts, nil
+}
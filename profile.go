@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// Starts a CPU profile written to cpuProfile when it is set. The returned function stops it
+// and writes a heap profile to memProfile when that is set; it must run before exiting.
+func startProfiling(cpuProfile, memProfile string) (func(), error) {
+	var cpuFile *os.File
+	if cpuProfile != "" {
+		file, err := os.Create(cpuProfile)
+		if err != nil {
+			return nil, fmt.Errorf("error creating CPU profile %s: %v", cpuProfile, err)
+		}
+		if err := pprof.StartCPUProfile(file); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("error starting CPU profile: %v", err)
+		}
+		cpuFile = file
+	}
+
+	return func() {
+		if cpuFile != nil {
+			pprof.StopCPUProfile()
+			cpuFile.Close()
+		}
+		if memProfile == "" {
+			return
+		}
+		file, err := os.Create(memProfile)
+		if err != nil {
+			logger.Error("creating memory profile", "path", memProfile, "error", err)
+			return
+		}
+		defer file.Close()
+		// Collect first so the profile reflects live memory
+		runtime.GC()
+		if err := pprof.WriteHeapProfile(file); err != nil {
+			logger.Error("writing memory profile", "path", memProfile, "error", err)
+		}
+	}, nil
+}